@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// The HTTP API exposes the boards of the users as JSON. Clients exchange a
+// username and password for a token at /api/token and send it as a bearer
+// token. Tokens are remembered sessions, so `todo-elm sessions` lists and
+// revokes them.
+
+// apiDate is the layout of due dates sent to the API.
+const apiDate = "2006-01-02"
+
+// apiTask is a task as sent and received by the API, with its status by
+// name and the board it is on.
+type apiTask struct {
+	persistence.Task
+	Status string `json:"status"` // persistence.TaskStatus.String()
+	Board  string `json:"board"`  // owner of the board
+}
+
+func newAPITask(owner string, t persistence.Task) apiTask {
+	return apiTask{Task: t, Status: t.Status.String(), Board: owner}
+}
+
+// taskInput holds the fields of a task to create or update. Fields left
+// out are not changed; an empty string clears the due date, priority or
+// assignee.
+type taskInput struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Status      *string   `json:"status"` // only when creating, see move
+	Priority    *string   `json:"priority"`
+	Tags        *[]string `json:"tags"`
+	Due         *string   `json:"due"` // YYYY-MM-DD
+	Assignee    *string   `json:"assignee"`
+}
+
+// apiBoard is a board the signed in user can open.
+type apiBoard struct {
+	Owner string           `json:"owner"`
+	Role  persistence.Role `json:"role"`
+}
+
+// apiError is an error with the HTTP status it is reported with.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+func badRequest(format string, args ...any) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+var errTaskNotFound = &apiError{http.StatusNotFound, "no such task"}
+
+// apiServer serves the HTTP API.
+type apiServer struct {
+	store persistence.Backend
+	ttl   time.Duration // of the tokens
+	// origin is allowed to call the API from a browser, if not empty.
+	origin string
+}
+
+// handler returns the routes of the API.
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", s.handle(s.createToken))
+	mux.HandleFunc("DELETE /api/token", s.handle(s.deleteToken))
+	mux.HandleFunc("GET /api/boards", s.authed(s.listBoards))
+	mux.HandleFunc("GET /api/boards/{owner}/tasks", s.authed(s.listTasks))
+	mux.HandleFunc("POST /api/boards/{owner}/tasks", s.authed(s.createTask))
+	mux.HandleFunc("GET /api/boards/{owner}/tasks/{id}", s.authed(s.getTask))
+	mux.HandleFunc("PATCH /api/boards/{owner}/tasks/{id}", s.authed(s.updateTask))
+	mux.HandleFunc("DELETE /api/boards/{owner}/tasks/{id}", s.authed(s.deleteTask))
+	mux.HandleFunc("POST /api/boards/{owner}/tasks/{id}/move", s.authed(s.moveTask))
+	mux.HandleFunc("GET /api/search", s.authed(s.search))
+	return s.cors(mux)
+}
+
+// handle adapts a handler returning an error, which is reported as JSON.
+func (s *apiServer) handle(h func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			status := errorStatus(err)
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+		}
+	}
+}
+
+// authed is handle for handlers needing a signed in user. The tasks of an
+// encrypted account are unlocked by the token for the request only.
+func (s *apiServer) authed(h func(w http.ResponseWriter, r *http.Request, username string) error) http.HandlerFunc {
+	return s.handle(func(w http.ResponseWriter, r *http.Request) error {
+		token, ok := bearerToken(r)
+		if !ok {
+			return &apiError{http.StatusUnauthorized, "missing bearer token; get one from POST /api/token"}
+		}
+		username, err := s.store.ResumeSession(token)
+		if err != nil {
+			return err
+		}
+		defer s.store.Lock(username)
+		return h(w, r, username)
+	})
+}
+
+// cors lets the configured origin call the API from a browser.
+func (s *apiServer) cors(next http.Handler) http.Handler {
+	if s.origin == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") == s.origin {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", s.origin)
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match")
+			h.Set("Access-Control-Expose-Headers", "ETag")
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE")
+			h.Add("Vary", "Origin")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// createToken signs in with a username and password, and the code of users
+// with two-factor authentication, and returns a new token.
+func (s *apiServer) createToken(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	var username string
+	var err error
+	if req.Code != "" {
+		username, err = s.store.AuthenticateUserWithCode(req.Username, req.Password, req.Code)
+	} else {
+		username, err = s.store.AuthenticateUser(req.Username, req.Password)
+	}
+	if err != nil {
+		return err
+	}
+	// The token unlocks the tasks from now on
+	defer s.store.Lock(username)
+	token, err := s.store.CreateSession(username, s.ttl)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"token":    token,
+		"username": username,
+		"expires":  time.Now().UTC().Add(s.ttl).Truncate(time.Second),
+	})
+	return nil
+}
+
+// deleteToken revokes the token of the request.
+func (s *apiServer) deleteToken(w http.ResponseWriter, r *http.Request) error {
+	token, ok := bearerToken(r)
+	if !ok {
+		return &apiError{http.StatusUnauthorized, "missing bearer token"}
+	}
+	if err := s.store.EndSession(token); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *apiServer) listBoards(w http.ResponseWriter, r *http.Request, username string) error {
+	boards, err := s.store.Boards(username)
+	if err != nil {
+		return err
+	}
+	out := make([]apiBoard, len(boards))
+	for i, b := range boards {
+		out[i] = apiBoard{Owner: b.Owner, Role: b.Role}
+	}
+	writeJSON(w, http.StatusOK, out)
+	return nil
+}
+
+// listTasks lists the tasks of a board column by column, optionally only
+// those of one status or matching a search, see taskQuery. The revision of
+// the board is sent as its ETag.
+func (s *apiServer) listTasks(w http.ResponseWriter, r *http.Request, username string) error {
+	q, err := parseTaskQuery(r)
+	if err != nil {
+		return err
+	}
+	owner := r.PathValue("owner")
+	b, err := s.store.LoadBoard(username, owner)
+	if err != nil {
+		return err
+	}
+	setRevision(w, b.Revision)
+	writeJSON(w, http.StatusOK, q.filter(owner, b))
+	return nil
+}
+
+// search lists the tasks matching a search on every board of the user.
+// Boards that cannot be read, e.g. an encrypted one whose owner has not
+// signed in since sharing it, are skipped.
+func (s *apiServer) search(w http.ResponseWriter, r *http.Request, username string) error {
+	q, err := parseTaskQuery(r)
+	if err != nil {
+		return err
+	}
+	boards, err := s.store.Boards(username)
+	if err != nil {
+		return err
+	}
+	tasks := []apiTask{}
+	for _, ref := range boards {
+		b, err := s.store.LoadBoard(username, ref.Owner)
+		if err != nil {
+			continue
+		}
+		tasks = append(tasks, q.filter(ref.Owner, b)...)
+	}
+	writeJSON(w, http.StatusOK, tasks)
+	return nil
+}
+
+func (s *apiServer) getTask(w http.ResponseWriter, r *http.Request, username string) error {
+	owner := r.PathValue("owner")
+	b, err := s.store.LoadBoard(username, owner)
+	if err != nil {
+		return err
+	}
+	col, i := findTask(b, r.PathValue("id"))
+	if i < 0 {
+		return errTaskNotFound
+	}
+	setRevision(w, b.Revision)
+	writeJSON(w, http.StatusOK, newAPITask(owner, b.Columns[col][i]))
+	return nil
+}
+
+// createTask adds a task at the end of a column, To Do unless a status is
+// given.
+func (s *apiServer) createTask(w http.ResponseWriter, r *http.Request, username string) error {
+	var in taskInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if in.Title == nil || strings.TrimSpace(*in.Title) == "" {
+		return badRequest("a title is required")
+	}
+	owner := r.PathValue("owner")
+	now := time.Now()
+	t := persistence.Task{ID: persistence.NewTaskID(), Status: persistence.Todo, Created: &now}
+	if in.Status != nil {
+		status, err := persistence.ParseTaskStatus(*in.Status)
+		if err != nil {
+			return badRequest("%v", err)
+		}
+		t.Status = status
+		if status == persistence.Done {
+			t.Completed = &now
+		}
+	}
+	if err := s.applyInput(&t, in, owner); err != nil {
+		return err
+	}
+
+	rev, err := s.update(r, username, owner, func(b *persistence.BoardTasks) error {
+		b.Columns[t.Status] = append(b.Columns[t.Status], t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setRevision(w, rev)
+	writeJSON(w, http.StatusCreated, newAPITask(owner, t))
+	return nil
+}
+
+// updateTask changes the fields of a task in place. Its status is changed
+// by moving it instead.
+func (s *apiServer) updateTask(w http.ResponseWriter, r *http.Request, username string) error {
+	var in taskInput
+	if err := readJSON(r, &in); err != nil {
+		return err
+	}
+	if in.Status != nil {
+		return badRequest("the status is changed with POST .../move")
+	}
+	if in.Title != nil && strings.TrimSpace(*in.Title) == "" {
+		return badRequest("the title cannot be empty")
+	}
+	owner := r.PathValue("owner")
+
+	var t persistence.Task
+	rev, err := s.update(r, username, owner, func(b *persistence.BoardTasks) error {
+		col, i := findTask(*b, r.PathValue("id"))
+		if i < 0 {
+			return errTaskNotFound
+		}
+		t = b.Columns[col][i]
+		if err := s.applyInput(&t, in, owner); err != nil {
+			return err
+		}
+		b.Columns[col][i] = t
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setRevision(w, rev)
+	writeJSON(w, http.StatusOK, newAPITask(owner, t))
+	return nil
+}
+
+func (s *apiServer) deleteTask(w http.ResponseWriter, r *http.Request, username string) error {
+	rev, err := s.update(r, username, r.PathValue("owner"), func(b *persistence.BoardTasks) error {
+		col, i := findTask(*b, r.PathValue("id"))
+		if i < 0 {
+			return errTaskNotFound
+		}
+		b.Columns[col] = slices.Delete(b.Columns[col], i, i+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setRevision(w, rev)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// moveTask moves a task to the end of the column of another status, as
+// the board does.
+func (s *apiServer) moveTask(w http.ResponseWriter, r *http.Request, username string) error {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	status, err := persistence.ParseTaskStatus(req.Status)
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	owner := r.PathValue("owner")
+
+	var t persistence.Task
+	rev, err := s.update(r, username, owner, func(b *persistence.BoardTasks) error {
+		col, i := findTask(*b, r.PathValue("id"))
+		if i < 0 {
+			return errTaskNotFound
+		}
+		t = b.Columns[col][i]
+		if col == int(status) {
+			return nil
+		}
+		b.Columns[col] = slices.Delete(b.Columns[col], i, i+1)
+		t.Status = status
+		t.Completed = nil
+		if status == persistence.Done {
+			now := time.Now()
+			t.Completed = &now
+		}
+		b.Columns[status] = append(b.Columns[status], t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	setRevision(w, rev)
+	writeJSON(w, http.StatusOK, newAPITask(owner, t))
+	return nil
+}
+
+// maxUpdateAttempts is how many times update applies a change to a board
+// that keeps being saved by someone else in between.
+const maxUpdateAttempts = 3
+
+// update applies change to the board of owner and saves it, returning its
+// new revision. If the board is saved by someone else in between, it is
+// loaded again and the change applied to it again, unless the request has
+// an If-Match header: the board must then be at that revision, or 412 is
+// returned, so that clients do not change what they have not seen.
+func (s *apiServer) update(r *http.Request, username, owner string, change func(b *persistence.BoardTasks) error) (uint64, error) {
+	match := r.Header.Get("If-Match")
+	for attempt := 1; ; attempt++ {
+		b, err := s.store.LoadBoard(username, owner)
+		if err != nil {
+			return 0, err
+		}
+		if match != "" && match != etag(b.Revision) {
+			return 0, &apiError{http.StatusPreconditionFailed, fmt.Sprintf("the board is at revision %d", b.Revision)}
+		}
+		if err := change(&b); err != nil {
+			return 0, err
+		}
+		rev, err := s.store.SaveBoard(username, owner, b)
+		if errors.Is(err, persistence.ErrConflict) && match == "" && attempt < maxUpdateAttempts {
+			continue
+		}
+		return rev, err
+	}
+}
+
+// findTask returns the column and index of the task with the given ID on
+// b, or an index of -1.
+func findTask(b persistence.BoardTasks, id string) (int, int) {
+	for col, tasks := range b.Columns {
+		for i, t := range tasks {
+			if t.ID == id {
+				return col, i
+			}
+		}
+	}
+	return 0, -1
+}
+
+func etag(rev uint64) string {
+	return fmt.Sprintf(`"%d"`, rev)
+}
+
+// setRevision sends the revision of the board a response is about as its
+// ETag, for If-Match.
+func setRevision(w http.ResponseWriter, rev uint64) {
+	w.Header().Set("ETag", etag(rev))
+}
+
+// applyInput sets the fields of t given in in, validating them.
+func (s *apiServer) applyInput(t *persistence.Task, in taskInput, owner string) error {
+	if in.Title != nil {
+		t.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.Description != nil {
+		t.Description = *in.Description
+	}
+	if in.Priority != nil {
+		p := strings.ToUpper(strings.TrimSpace(*in.Priority))
+		if len(p) > 1 || (p != "" && (p[0] < 'A' || p[0] > 'Z')) {
+			return badRequest("invalid priority %q (want A-Z)", *in.Priority)
+		}
+		t.Priority = p
+	}
+	if in.Tags != nil {
+		t.Tags = *in.Tags
+	}
+	if in.Due != nil {
+		t.Due = nil
+		if *in.Due != "" {
+			due, err := time.Parse(apiDate, *in.Due)
+			if err != nil {
+				return badRequest("invalid due date %q (want YYYY-MM-DD)", *in.Due)
+			}
+			t.Due = &due
+		}
+	}
+	if in.Assignee != nil {
+		if *in.Assignee != "" {
+			members, err := s.store.BoardMembers(owner)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(members, *in.Assignee) {
+				return badRequest("%s is not a member of the board", *in.Assignee)
+			}
+		}
+		t.Assignee = *in.Assignee
+	}
+	return nil
+}
+
+// taskQuery selects the tasks listed, from the query string: status, q,
+// searched case-insensitively in the title, description and tags, and
+// assignee.
+type taskQuery struct {
+	statuses []persistence.TaskStatus
+	text     string
+	assignee string
+}
+
+func parseTaskQuery(r *http.Request) (taskQuery, error) {
+	v := r.URL.Query()
+	q := taskQuery{
+		statuses: persistence.Statuses,
+		text:     strings.ToLower(v.Get("q")),
+		assignee: v.Get("assignee"),
+	}
+	if name := v.Get("status"); name != "" {
+		status, err := persistence.ParseTaskStatus(name)
+		if err != nil {
+			return q, badRequest("%v", err)
+		}
+		q.statuses = []persistence.TaskStatus{status}
+	}
+	return q, nil
+}
+
+// filter returns the tasks of b matching q, column by column.
+func (q taskQuery) filter(owner string, b persistence.BoardTasks) []apiTask {
+	tasks := []apiTask{}
+	for _, status := range q.statuses {
+		for _, t := range b.Columns[status] {
+			if q.matches(t) {
+				tasks = append(tasks, newAPITask(owner, t))
+			}
+		}
+	}
+	return tasks
+}
+
+func (q taskQuery) matches(t persistence.Task) bool {
+	if q.assignee != "" && t.Assignee != q.assignee {
+		return false
+	}
+	if q.text == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(t.Title), q.text) || strings.Contains(strings.ToLower(t.Description), q.text) {
+		return true
+	}
+	return slices.ContainsFunc(t.Tags, func(tag string) bool {
+		return strings.Contains(strings.ToLower(tag), q.text)
+	})
+}
+
+// errorStatus returns the HTTP status err is reported with.
+func errorStatus(err error) int {
+	var apiErr *apiError
+	var lockedErr *persistence.LockedError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.status
+	case errors.As(err, &lockedErr):
+		return http.StatusTooManyRequests
+	case errors.Is(err, persistence.ErrInvalidCredentials),
+		errors.Is(err, persistence.ErrSecondFactorRequired),
+		errors.Is(err, persistence.ErrInvalidCode),
+		errors.Is(err, persistence.ErrSessionInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, persistence.ErrPermissionDenied),
+		errors.Is(err, persistence.ErrAccountDisabled),
+		errors.Is(err, persistence.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, persistence.ErrLocked):
+		return http.StatusLocked
+	case errors.Is(err, persistence.ErrConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// maxRequestBody limits the size of the JSON bodies the API reads.
+const maxRequestBody = 1 << 20
+
+func readJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
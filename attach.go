@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// errNoInstance is returned by attach when no process listens on the
+// instance socket.
+var errNoInstance = errors.New("no todo-elm is listening")
+
+// attach runs the board of the process that has the database of baseDir
+// open in this terminal, until either quits.
+func attach(baseDir string) error {
+	conn, err := net.Dial("unix", instanceSocketPath(baseDir))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNoInstance, err)
+	}
+	defer conn.Close()
+
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("attaching needs a terminal")
+	}
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, state)
+
+	// Frames are written by the input and resize loops
+	var mu sync.Mutex
+	send := func(kind byte, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeFrame(conn, kind, payload)
+	}
+	sendSize := func() error {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			return err
+		}
+		return send(frameResize, resizeFrame(width, height))
+	}
+	if err := sendSize(); err != nil {
+		return err
+	}
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	defer stopResize(resized)
+	go func() {
+		for range resized {
+			if sendSize() != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 && send(frameInput, buf[:n]) != nil {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
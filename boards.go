@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"github.com/ReggieReo/todo-elm/theme"
+	"github.com/ReggieReo/todo-elm/todolist"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+type boardSharedMsg struct{ status string }
+
+// stopSharing is the role option of the share form that removes a member.
+const stopSharing = "stop"
+
+// shareBoardCmd creates a tea.Cmd that shares the board of owner with member
+// as role, or stops sharing it.
+func shareBoardCmd(store persistence.Backend, owner, member, role string) tea.Cmd {
+	return func() tea.Msg {
+		if role == stopSharing {
+			if err := store.UnshareBoard(owner, member); err != nil {
+				return authErrMsg{err}
+			}
+			return boardSharedMsg{status: fmt.Sprintf("Stopped sharing your board with %s.", member)}
+		}
+		if err := store.ShareBoard(owner, member, persistence.Role(role)); err != nil {
+			return authErrMsg{err}
+		}
+		return boardSharedMsg{status: fmt.Sprintf("Shared your board with %s as %s.", member, role)}
+	}
+}
+
+// boardTitle names a board in the board list.
+func boardTitle(ref persistence.BoardRef) string {
+	if ref.Role == persistence.RoleOwner {
+		return "Your board"
+	}
+	return fmt.Sprintf("%s's board (%s)", ref.Owner, ref.Role)
+}
+
+// createBoardForm lists the boards the user can open, with current selected.
+func createBoardForm(boards []persistence.BoardRef, current string) *huh.Form {
+	options := make([]huh.Option[string], len(boards))
+	for i, ref := range boards {
+		options[i] = huh.NewOption(boardTitle(ref), ref.Owner).Selected(ref.Owner == current)
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Key("board").
+				Title("Open board").
+				Options(options...),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+// createShareForm shares the user's board, listing who has it already.
+func createShareForm(shares []persistence.Share) *huh.Form {
+	members := "Not shared with anyone yet."
+	if len(shares) > 0 {
+		names := make([]string, len(shares))
+		for i, sh := range shares {
+			names[i] = fmt.Sprintf("%s (%s)", sh.Member, sh.Role)
+		}
+		members = "Shared with " + strings.Join(names, ", ") + "."
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("member").
+				Title("Share your board with").
+				Description(members).
+				Placeholder("Enter a username").
+				Validate(func(s string) error {
+					if strings.TrimSpace(s) == "" {
+						return errors.New("username cannot be empty")
+					}
+					return nil
+				}),
+			huh.NewSelect[string]().
+				Key("role").
+				Title("Role").
+				Options(
+					huh.NewOption("Editor: can change tasks", string(persistence.RoleEditor)),
+					huh.NewOption("Viewer: can only read them", string(persistence.RoleViewer)),
+					huh.NewOption("Stop sharing", stopSharing),
+				),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+// openFirstBoard opens a board after signing in: the one configured for the
+// user, or their own, asking which one when others are shared with them.
+func (m model) openFirstBoard() (tea.Model, tea.Cmd) {
+	boards, err := m.store.Boards(m.username)
+	if err != nil {
+		boards = boards[:1] // their own board is always listed
+	}
+	ref := boards[0]
+	owner, configured := todolist.BoardToOpen(m.username)
+	status := ""
+	if configured {
+		status = fmt.Sprintf("%s's board is not shared with you.", owner)
+		for _, b := range boards {
+			if b.Owner == owner {
+				ref, status = b, ""
+			}
+		}
+	}
+	b := todolist.OpenBoard(m.username, ref, m.store)
+	if status != "" {
+		b.SetStatus(status)
+	}
+	m.board = b
+	if len(boards) > 1 && !configured {
+		m.state = pickBoard
+		m.form = createBoardForm(boards, ref.Owner)
+		return m, tea.Batch(m.form.Init(), b.Init())
+	}
+	res, cmd := m.backToBoard()
+	return res, tea.Batch(cmd, b.Init())
+}
+
+// openBoardPicker lists the boards to switch to over the board.
+func (m model) openBoardPicker() (tea.Model, tea.Cmd) {
+	b, _ := m.board.(*todolist.Board)
+	boards, err := m.store.Boards(m.username)
+	if err != nil {
+		b.SetStatus(fmt.Sprintf("Could not list boards: %v", err))
+		return m, nil
+	}
+	if len(boards) == 1 {
+		b.SetStatus("No boards are shared with you.")
+		return m, nil
+	}
+	m.state = pickBoard
+	m.form = createBoardForm(boards, b.Owner())
+	m.err = nil
+	return m, m.form.Init()
+}
+
+// switchBoard opens the board of owner, chosen in the board list.
+func (m model) switchBoard(owner string) (tea.Model, tea.Cmd) {
+	if b, ok := m.board.(*todolist.Board); ok && b.Owner() == owner {
+		return m.backToBoard()
+	}
+	role, err := m.store.BoardRole(m.username, owner)
+	if err != nil {
+		if b, ok := m.board.(*todolist.Board); ok {
+			b.SetStatus(fmt.Sprintf("Could not open %s's board: %v", owner, err))
+		}
+		return m.backToBoard()
+	}
+	b := todolist.OpenBoard(m.username, persistence.BoardRef{Owner: owner, Role: role}, m.store)
+	m.board = b
+	res, cmd := m.backToBoard()
+	return res, tea.Batch(cmd, b.Init())
+}
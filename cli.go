@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ReggieReo/todo-elm/config"
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"golang.org/x/term"
+)
+
+// command is run instead of the TUI when its name is the first argument,
+// e.g. `todo-elm export -user alice`.
+type command struct {
+	usage string // arguments, shown in the usage message
+	help  string // one line summary
+	run   func(a *app, args []string) error
+	// noStore commands open the database themselves, if at all.
+	noStore bool
+}
+
+// app holds what the commands share.
+type app struct {
+	baseDir  string
+	cfg      config.Config
+	readOnly bool // -read-only was given
+	store    persistence.Backend
+}
+
+// commands is filled in init; newFlagSet reads it, so it cannot be a
+// composite literal referring to the run functions.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"admin": {
+			usage: "users | reset-password -user NAME [-yes] | disable -user NAME | enable -user NAME | rename -user NAME -to NAME | stats [-user NAME]",
+			help:  "manage users directly in the database, without signing in",
+			run:   runAdmin,
+		},
+		"backup": {
+			usage: "[-o FILE] [-compress]",
+			help:  "write a full backup of the database",
+			run:   runBackup,
+		},
+		"restore": {
+			usage:   "[-yes] FILE",
+			help:    "replace the database with a backup",
+			run:     runRestore,
+			noStore: true,
+		},
+		"export": {
+			usage: "-user NAME [-board OWNER] [-format json|csv|md|txt|ics|taskwarrior] [-o FILE]",
+			help:  "export the boards of a user",
+			run:   runExport,
+		},
+		"ical": {
+			usage: "-user NAME [-o FILE] [-events]",
+			help:  "export the tasks of a user that have a due date as iCalendar",
+			run:   runICal,
+		},
+		"import": {
+			usage: "-user NAME [-format json|csv|md|txt|taskwarrior] [-map field=Header,...] [-column NAME] [-dry-run] [-yes] FILE",
+			help:  "import tasks into the board of a user",
+			run:   runImport,
+		},
+		"passwd": {
+			usage: "-user NAME",
+			help:  "change the password of a user",
+			run:   runPasswd,
+		},
+		"delete-account": {
+			usage: "-user NAME [-yes]",
+			help:  "delete a user and all of their tasks",
+			run:   runDeleteAccount,
+		},
+		"sessions": {
+			usage: "-user NAME [-revoke ID|all]",
+			help:  "list or revoke the remembered sessions of a user",
+			run:   runSessions,
+		},
+		"daemon": {
+			usage:   "",
+			help:    "keep the database open for the board, commands and editors to share",
+			run:     runDaemon,
+			noStore: true,
+		},
+		"serve": {
+			usage: "[-ssh [-ssh-addr ADDR] [-host-key FILE]] [-http [-http-addr ADDR] [-http-origin URL]]",
+			help:  "serve the board to remote terminals, or as a JSON API over HTTP",
+			run:   runServe,
+		},
+		"share": {
+			usage: "-user NAME [-with NAME [-role editor|viewer] | -revoke NAME]",
+			help:  "share the board of a user, or list who it is shared with",
+			run:   runShare,
+		},
+		"ssh-keys": {
+			usage: "-user NAME [-add FILE | -remove FINGERPRINT]",
+			help:  "list or change the public keys a user can sign in to the SSH server with",
+			run:   runSSHKeys,
+		},
+		"totp": {
+			usage: "-user NAME [-disable]",
+			help:  "set up or turn off two-factor authentication for a user",
+			run:   runTOTP,
+		},
+		"todotxt-sync": {
+			usage: "-user NAME [-file FILE]",
+			help:  "reconcile the board of a user with a todo.txt file",
+			run:   runTodoTxtSync,
+		},
+	}
+}
+
+// errUsage is returned by commands when their arguments are invalid; the
+// flag set has already printed the reason.
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs the named command with its arguments, opening the store
+// for it unless the command does so itself.
+func runCommand(a *app, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	if !cmd.noStore {
+		store, err := connectStore(a.baseDir, a.cfg, a.readOnly)
+		if errors.Is(err, persistence.ErrInUse) {
+			return fmt.Errorf("%w; try again once it has quit, or with -read-only", err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to initialize persistence store: %w", err)
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				log.Printf("Error closing persistence store: %v", err)
+			}
+		}()
+		a.store = store
+	}
+	return cmd.run(a, args)
+}
+
+// connectStore returns the store of the daemon of baseDir, connected as an
+// administrator, if one is running, and otherwise opens it, see openStore.
+// A read-only store is always opened.
+func connectStore(baseDir string, cfg config.Config, readOnly bool) (persistence.Backend, error) {
+	if !readOnly {
+		if store, err := persistence.DialStore(daemonSocketPath(baseDir)); err == nil {
+			if err := administer(store, baseDir); err != nil {
+				store.Close()
+				return nil, err
+			}
+			return store, nil
+		}
+	}
+	return openStore(baseDir, cfg, readOnly)
+}
+
+// openStore opens the store in baseDir with the security settings of cfg,
+// read-only if asked to.
+func openStore(baseDir string, cfg config.Config, readOnly bool) (*persistence.Store, error) {
+	newStore := persistence.NewStore
+	if readOnly {
+		newStore = persistence.NewReadOnlyStore
+	}
+	store, err := newStore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Security.Encrypt {
+		store.EnableEncryption()
+	}
+	store.SetThrottle(cfg.Security.MaxAttempts, cfg.Security.Lockout)
+	store.SetHashing(cfg.Password.Algorithm, cfg.Password.BcryptCost)
+	return store, nil
+}
+
+// usage prints the global flags and the list of commands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: todo-elm [flags] [command [arguments]]\n\n")
+	fmt.Fprintf(out, "Without a command the board is opened in the terminal.\n\nFlags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-14s %s\n  %-14s   %s %s\n", name, commands[name].help, "", name, commands[name].usage)
+	}
+}
+
+// newFlagSet returns a flag set for the named command that reports errors
+// instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: todo-elm %s %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readPassword returns the password from the TODO_ELM_PASSWORD environment
+// variable, or prompts for it on the terminal without echo.
+func readPassword(prompt string) (string, error) {
+	if p, ok := os.LookupEnv("TODO_ELM_PASSWORD"); ok {
+		return p, nil
+	}
+	return readPasswordPrompt(prompt, "TODO_ELM_PASSWORD")
+}
+
+// readPasswordPrompt prompts for a password on the terminal without echo.
+// env names the variable to set instead when there is no terminal.
+func readPasswordPrompt(prompt, env string) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal to read the password from; set %s", env)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(string(pw), "\r\n"), nil
+}
+
+// confirm asks a yes/no question on the terminal; anything but "y" or "yes"
+// is a no.
+func confirm(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// readLine asks for one line of input on the terminal.
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readCode returns the authentication code from the TODO_ELM_TOTP_CODE
+// environment variable, or prompts for it.
+func readCode() (string, error) {
+	if c, ok := os.LookupEnv("TODO_ELM_TOTP_CODE"); ok {
+		return c, nil
+	}
+	return readLine("Authentication code (or recovery code): ")
+}
+
+// signIn authenticates username with a password read by readPassword.
+func (a *app) signIn(username string) (string, error) {
+	if username == "" {
+		return "", errors.New("-user is required")
+	}
+	password, err := readPassword(fmt.Sprintf("Password for %s: ", username))
+	if err != nil {
+		return "", err
+	}
+	return a.authenticate(username, password)
+}
+
+// authenticate signs username in with password, asking for an
+// authentication code if the user has two-factor authentication.
+func (a *app) authenticate(username, password string) (string, error) {
+	uname, err := a.store.AuthenticateUser(username, password)
+	if err != persistence.ErrSecondFactorRequired {
+		return uname, err
+	}
+	code, err := readCode()
+	if err != nil {
+		return "", err
+	}
+	return a.store.AuthenticateUserWithCode(username, password, code)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// runPasswd changes the password of a user.
+func runPasswd(a *app, args []string) error {
+	fs := newFlagSet("passwd")
+	user := fs.String("user", "", "user whose password is changed")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	current, err := readPassword(fmt.Sprintf("Current password for %s: ", *user))
+	if err != nil {
+		return err
+	}
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	username, err := a.authenticate(*user, current)
+	if err != nil {
+		return err
+	}
+	if err := a.store.ChangePassword(username, current, password); err != nil {
+		return err
+	}
+	fmt.Println("Password changed.")
+	return nil
+}
+
+// runDeleteAccount deletes a user and all of their tasks.
+func runDeleteAccount(a *app, args []string) error {
+	fs := newFlagSet("delete-account")
+	user := fs.String("user", "", "user to delete")
+	yes := fs.Bool("yes", false, "delete without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	password, err := readPassword(fmt.Sprintf("Password for %s: ", *user))
+	if err != nil {
+		return err
+	}
+	username, err := a.authenticate(*user, password)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Delete %s and all of their tasks? This cannot be undone.", username))
+		if err != nil || !ok {
+			return err
+		}
+	}
+	if err := a.store.DeleteUser(username, password); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %s.\n", username)
+	return nil
+}
+
+// readNewPassword returns the password from the TODO_ELM_NEW_PASSWORD
+// environment variable, or prompts for it twice on the terminal.
+func readNewPassword() (string, error) {
+	password, ok := os.LookupEnv("TODO_ELM_NEW_PASSWORD")
+	if !ok {
+		var err error
+		if password, err = readPasswordPrompt("New password: ", "TODO_ELM_NEW_PASSWORD"); err != nil {
+			return "", err
+		}
+		again, err := readPasswordPrompt("Confirm new password: ", "TODO_ELM_NEW_PASSWORD")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", errors.New("passwords do not match")
+		}
+	}
+	return password, validatePassword(password)
+}
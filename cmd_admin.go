@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// adminCommands are the subcommands of admin. They work on the database
+// directly, without signing the user in.
+var adminCommands = map[string]func(a *app, args []string) error{
+	"users":          runAdminUsers,
+	"reset-password": runAdminResetPassword,
+	"disable":        func(a *app, args []string) error { return runAdminDisable(a, args, true) },
+	"enable":         func(a *app, args []string) error { return runAdminDisable(a, args, false) },
+	"rename":         runAdminRename,
+	"stats":          runAdminStats,
+}
+
+// runAdmin runs the admin subcommand named by the first argument.
+func runAdmin(a *app, args []string) error {
+	if len(args) == 0 {
+		newFlagSet("admin").Usage()
+		return errUsage
+	}
+	run, ok := adminCommands[args[0]]
+	if !ok {
+		newFlagSet("admin").Usage()
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+	return run(a, args[1:])
+}
+
+// runAdminUsers lists every user.
+func runAdminUsers(a *app, args []string) error {
+	fs := newFlagSet("admin")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	users, err := a.store.Users()
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		fmt.Println("No users.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tSTATUS\tENCRYPTED\t2FA\tSESSIONS")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", u.Username, accountStatus(u), yesNo(u.Encrypted), yesNo(u.TOTP), u.Sessions)
+	}
+	return tw.Flush()
+}
+
+// runAdminResetPassword sets a new password for a user who forgot theirs.
+func runAdminResetPassword(a *app, args []string) error {
+	fs := newFlagSet("admin")
+	user := fs.String("user", "", "user whose password is reset")
+	yes := fs.Bool("yes", false, "delete the tasks of an encrypted account without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	info, err := a.store.User(*user)
+	if err != nil {
+		return err
+	}
+	if info.Encrypted && !*yes {
+		ok, err := confirm(fmt.Sprintf("The tasks of %s are encrypted with their password and will be deleted. Continue?", info.Username))
+		if err != nil || !ok {
+			return err
+		}
+	}
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	discarded, err := a.store.ResetPassword(info.Username, password)
+	if err != nil {
+		return err
+	}
+	if discarded {
+		fmt.Printf("Password of %s reset; their encrypted tasks were deleted.\n", info.Username)
+		return nil
+	}
+	fmt.Printf("Password of %s reset.\n", info.Username)
+	return nil
+}
+
+// runAdminDisable disables or enables the account of a user.
+func runAdminDisable(a *app, args []string, disable bool) error {
+	fs := newFlagSet("admin")
+	user := fs.String("user", "", "user whose account is changed")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+	info, err := a.store.User(*user)
+	if err != nil {
+		return err
+	}
+	if err := a.store.SetDisabled(info.Username, disable); err != nil {
+		return err
+	}
+	if disable {
+		fmt.Printf("Disabled %s and revoked their sessions.\n", info.Username)
+	} else {
+		fmt.Printf("Enabled %s.\n", info.Username)
+	}
+	return nil
+}
+
+// runAdminRename renames a user.
+func runAdminRename(a *app, args []string) error {
+	fs := newFlagSet("admin")
+	user := fs.String("user", "", "user to rename")
+	to := fs.String("to", "", "new username")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" || *to == "" {
+		return errors.New("-user and -to are required")
+	}
+	info, err := a.store.User(*user)
+	if err != nil {
+		return err
+	}
+	name, err := a.store.RenameUser(info.Username, *to)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Renamed %s to %s.\n", info.Username, name)
+	return nil
+}
+
+// runAdminStats shows how many tasks each user has in each column.
+func runAdminStats(a *app, args []string) error {
+	fs := newFlagSet("admin")
+	user := fs.String("user", "", "only show this user")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	var users []persistence.UserInfo
+	if *user != "" {
+		info, err := a.store.User(*user)
+		if err != nil {
+			return err
+		}
+		users = []persistence.UserInfo{info}
+	} else {
+		var err error
+		if users, err = a.store.Users(); err != nil {
+			return err
+		}
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "USER")
+	for _, status := range persistence.Statuses {
+		fmt.Fprintf(tw, "\t%s", status)
+	}
+	fmt.Fprintln(tw, "\tTOTAL")
+	for _, u := range users {
+		fmt.Fprint(tw, u.Username)
+		counts, err := a.store.TaskCounts(u.Username)
+		if errors.Is(err, persistence.ErrLocked) {
+			fmt.Fprintln(tw, "\t(encrypted)")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed counting the tasks of %s: %w", u.Username, err)
+		}
+		total := 0
+		for _, status := range persistence.Statuses {
+			fmt.Fprintf(tw, "\t%d", counts[status])
+			total += counts[status]
+		}
+		fmt.Fprintf(tw, "\t%d\n", total)
+	}
+	return tw.Flush()
+}
+
+func accountStatus(u persistence.UserInfo) string {
+	if u.Disabled {
+		return "disabled"
+	}
+	return "active"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// runBackup writes a full backup of the database.
+func runBackup(a *app, args []string) error {
+	fs := newFlagSet("backup")
+	out := fs.String("o", "", "output file (default: stdout)")
+	compress := fs.Bool("compress", false, "gzip the backup (default: when -o ends in .gz or .tgz)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	gz := *compress || strings.HasSuffix(*out, ".gz") || strings.HasSuffix(*out, ".tgz")
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "" {
+		var err error
+		if f, err = os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600); err != nil {
+			return err
+		}
+		w = f
+	}
+	m, err := a.store.Backup(w, gz)
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(*out)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Backed up %d users (%d keys, schema version %d)", m.Users, m.Keys, m.SchemaVersion)
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, " to %s", *out)
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+// runRestore replaces the database with a backup. It runs without the
+// store open, since the live database is moved aside.
+func runRestore(a *app, args []string) error {
+	fs := newFlagSet("restore")
+	yes := fs.Bool("yes", false, "restore without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	if a.readOnly {
+		return persistence.ErrReadOnly
+	}
+	path := fs.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	m, err := persistence.ReadBackupManifest(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("Backup from %s: %d users, %d keys, schema version %d.\n",
+		m.Created.Local().Format("2006-01-02 15:04:05"), m.Users, m.Keys, m.SchemaVersion)
+	if !*yes {
+		ok, err := confirm("Replace all current data with this backup?")
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	if f, err = os.Open(path); err != nil {
+		return err
+	}
+	defer f.Close()
+	_, previous, err := persistence.Restore(a.baseDir, f)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Restored.")
+	if previous != "" {
+		fmt.Printf("The previous database was kept in %s; delete it once you are happy with the restore.\n", previous)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// runExport writes the boards of a user to a file or stdout.
+func runExport(a *app, args []string) error {
+	fs := newFlagSet("export")
+	user := fs.String("user", "", "user whose boards are exported")
+	format := fs.String("format", "", "json, csv, md, txt, ics or taskwarrior (default: from -o, else json)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	board := fs.String("board", "", "owner of a board shared with the user to export instead of their own")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	f := interchange.JSON
+	var err error
+	switch {
+	case *format != "":
+		f, err = interchange.ParseFormat(*format)
+	case *out != "":
+		f, err = interchange.FormatFromPath(*out)
+	}
+	if err != nil {
+		return err
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+	owner := username
+	if *board != "" {
+		owner = *board
+		if canonical, err := persistence.NormalizeUsername(*board); err == nil {
+			owner = canonical
+		}
+	}
+	doc, err := interchange.LoadBoardDocument(a.store, username, owner, a.cfg.Board.Columns)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return interchange.Write(os.Stdout, f, doc)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := interchange.Write(file, f, doc); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s's board to %s\n", owner, *out)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+)
+
+// runICal writes the tasks of a user that have a due date as an iCalendar
+// file.
+func runICal(a *app, args []string) error {
+	fs := newFlagSet("ical")
+	user := fs.String("user", "", "user whose tasks are exported")
+	out := fs.String("o", "", "output file (default: the file configured for the user, else stdout)")
+	events := fs.Bool("events", false, "also add an all-day event on each due date (default: from the config)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	opts := interchange.ICalOptions{Events: *events || a.cfg.ICal.Events}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+	doc, err := interchange.LoadDocument(a.store, username, a.cfg.Board.Columns)
+	if err != nil {
+		return err
+	}
+
+	path := *out
+	if path == "" {
+		path = a.cfg.ICal.Files[username]
+	}
+	if path == "" {
+		return interchange.WriteICal(os.Stdout, doc, opts)
+	}
+	if err := interchange.WriteICalFile(path, doc, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// runImport reads tasks from a file, previews what would be added and, once
+// confirmed, appends the new tasks to the user's board.
+func runImport(a *app, args []string) error {
+	fs := newFlagSet("import")
+	user := fs.String("user", "", "user whose board receives the tasks")
+	format := fs.String("format", "", "json, csv, md, txt or taskwarrior (default: from the file extension)")
+	mapping := fs.String("map", "", "CSV headers holding each field, e.g. title=Name,description=Notes,column=State")
+	column := fs.String("column", persistence.Todo.String(), "column for tasks whose file does not name one")
+	dryRun := fs.Bool("dry-run", false, "only show what would be imported")
+	yes := fs.Bool("yes", false, "import without asking for confirmation")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	path := fs.Arg(0)
+
+	opts := interchange.ImportOptions{Titles: a.cfg.Board.Columns}
+	var err error
+	if opts.Column, err = persistence.ParseTaskStatus(*column); err != nil {
+		return err
+	}
+	if opts.Mapping, err = parseMapping(*mapping); err != nil {
+		return err
+	}
+	switch {
+	case *format != "":
+		opts.Format, err = interchange.ParseFormat(*format)
+	case path == "-":
+		err = errors.New("-format is required when reading from stdin")
+	default:
+		opts.Format, err = interchange.FormatFromPath(path)
+	}
+	if err != nil {
+		return err
+	}
+	if path == "-" && !*yes && !*dryRun {
+		return errors.New("-yes is required when reading from stdin")
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	incoming, err := interchange.Read(r, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+	existing, err := interchange.LoadBoardTasks(a.store, username)
+	if err != nil {
+		return err
+	}
+	plan := interchange.PlanImport(existing, incoming)
+	printPlan(os.Stdout, plan, a.cfg.Board.Columns)
+
+	if *dryRun || len(plan.Add) == 0 {
+		return nil
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Import %d tasks into %s's board?", len(plan.Add), username))
+		if err != nil || !ok {
+			return err
+		}
+	}
+	if err := plan.Apply(a.store, username); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d tasks.\n", len(plan.Add))
+	return nil
+}
+
+// parseMapping parses "field=Header,field=Header" into a map.
+func parseMapping(s string) (map[string]string, error) {
+	m := map[string]string{}
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(field) == "" || strings.TrimSpace(header) == "" {
+			return nil, fmt.Errorf("invalid -map entry %q (want field=Header)", pair)
+		}
+		m[strings.TrimSpace(field)] = strings.TrimSpace(header)
+	}
+	return m, nil
+}
+
+// printPlan lists the tasks an import would add and those it would skip.
+func printPlan(w io.Writer, plan interchange.Plan, titles map[string]string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	list := func(heading string, tasks []persistence.Task) {
+		fmt.Fprintf(tw, "%s (%d):\n", heading, len(tasks))
+		for _, t := range tasks {
+			fmt.Fprintf(tw, "  %s\t%s\n", titles[t.Status.String()], t.Title)
+		}
+	}
+	list("Tasks to import", plan.Add)
+	if len(plan.Duplicates) > 0 {
+		list("Duplicates skipped", plan.Duplicates)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// runSessions lists or revokes the remembered sessions of a user.
+func runSessions(a *app, args []string) error {
+	fs := newFlagSet("sessions")
+	user := fs.String("user", "", "user whose sessions are listed")
+	revoke := fs.String("revoke", "", `ID of the session to revoke, or "all"`)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+
+	if *revoke != "" {
+		id := *revoke
+		if id == "all" {
+			id = ""
+		}
+		n, err := a.store.RevokeSession(username, id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("no session %q", *revoke)
+		}
+		fmt.Printf("Revoked %d session(s).\n", n)
+		return nil
+	}
+
+	sessions, err := a.store.Sessions(username)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Println("No remembered sessions.")
+		return nil
+	}
+	current := ""
+	if token := readSessionToken(sessionPath(a.baseDir)); token != "" {
+		current = persistence.SessionID(token)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tEXPIRES\t")
+	for _, sess := range sessions {
+		mark := ""
+		if sess.ID == current {
+			mark = "(this computer)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", sess.ID,
+			sess.Created.Local().Format("2006-01-02 15:04"), sess.Expires.Local().Format("2006-01-02 15:04"), mark)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// runShare shares the board of a user with another one, stops sharing it,
+// or lists the shares of the user's board and of the boards shared with
+// them.
+func runShare(a *app, args []string) error {
+	fs := newFlagSet("share")
+	user := fs.String("user", "", "owner of the board")
+	with := fs.String("with", "", "user to share the board with")
+	role := fs.String("role", string(persistence.RoleEditor), "editor or viewer")
+	revoke := fs.String("revoke", "", "user to stop sharing the board with")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *with != "" && *revoke != "" {
+		return errors.New("-with and -revoke cannot be combined")
+	}
+	r, err := persistence.ParseRole(*role)
+	if err != nil {
+		return err
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *with != "":
+		if err := a.store.ShareBoard(username, *with, r); err != nil {
+			return err
+		}
+		fmt.Printf("Shared %s's board with %s as %s.\n", username, *with, r)
+		return nil
+	case *revoke != "":
+		if err := a.store.UnshareBoard(username, *revoke); err != nil {
+			return err
+		}
+		fmt.Printf("Stopped sharing %s's board with %s.\n", username, *revoke)
+		return nil
+	}
+
+	shares, err := a.store.Shares(username)
+	if err != nil {
+		return err
+	}
+	boards, err := a.store.Boards(username)
+	if err != nil {
+		return err
+	}
+	if len(shares) == 0 && len(boards) == 1 {
+		fmt.Println("No shared boards.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OWNER\tMEMBER\tROLE")
+	for _, sh := range shares {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", sh.Owner, sh.Member, sh.Role)
+	}
+	for _, b := range boards[1:] {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", b.Owner, username, b.Role)
+	}
+	return tw.Flush()
+}
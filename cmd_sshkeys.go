@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// runSSHKeys lists, adds or removes the public keys a user can sign in to
+// the SSH server with.
+func runSSHKeys(a *app, args []string) error {
+	fs := newFlagSet("ssh-keys")
+	user := fs.String("user", "", "user whose keys are managed")
+	add := fs.String("add", "", "public key file to add, e.g. ~/.ssh/id_ed25519.pub")
+	remove := fs.String("remove", "", "fingerprint of the key to remove")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *add != "" && *remove != "" {
+		return errors.New("-add and -remove cannot be combined")
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *add != "":
+		line, err := os.ReadFile(*add)
+		if err != nil {
+			return err
+		}
+		ak, err := a.store.AddAuthorizedKey(username, string(line))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added %s for %s.\n", ak.Fingerprint, username)
+		if info, err := a.store.User(username); err == nil && info.Encrypted {
+			fmt.Println("Your tasks are encrypted, so the server still asks for your password to unlock them.")
+		}
+		return nil
+	case *remove != "":
+		if err := a.store.RemoveAuthorizedKey(username, *remove); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s for %s.\n", *remove, username)
+		return nil
+	}
+
+	keys, err := a.store.AuthorizedKeys(username)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fmt.Println("No keys.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FINGERPRINT\tCOMMENT\tADDED")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", k.Fingerprint, k.Comment, k.Added.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
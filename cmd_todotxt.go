@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+)
+
+// runTodoTxtSync reconciles a user's board with their todo.txt file once.
+func runTodoTxtSync(a *app, args []string) error {
+	fs := newFlagSet("todotxt-sync")
+	user := fs.String("user", "", "user whose board is synced")
+	file := fs.String("file", "", "todo.txt file (default: the file configured for the user)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	path := *file
+	if path == "" {
+		path = a.cfg.TodoTxt.Sync[*user]
+	}
+	if path == "" {
+		return errors.New("no todo.txt file configured for the user; pass -file")
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+	res, err := interchange.SyncTodoTxt(a.store, username, path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Synced %s: %d changes from the file, %d conflicts (board version kept).\n", path, res.FromFile, res.Conflicts)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// runTOTP enrolls a user in two-factor authentication, or turns it off.
+func runTOTP(a *app, args []string) error {
+	fs := newFlagSet("totp")
+	user := fs.String("user", "", "user to set up")
+	disable := fs.Bool("disable", false, "turn two-factor authentication off")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *user == "" {
+		return errors.New("-user is required")
+	}
+
+	if *disable {
+		password, err := readPassword(fmt.Sprintf("Password for %s: ", *user))
+		if err != nil {
+			return err
+		}
+		code, err := readCode()
+		if err != nil {
+			return err
+		}
+		if err := a.store.DisableTOTP(*user, password, code); err != nil {
+			return err
+		}
+		fmt.Println("Two-factor authentication turned off.")
+		return nil
+	}
+
+	username, err := a.signIn(*user)
+	if err != nil {
+		return err
+	}
+	if enabled, err := a.store.TOTPEnabled(username); err != nil || enabled {
+		if enabled {
+			n, _ := a.store.RecoveryCodesLeft(username)
+			fmt.Printf("Two-factor authentication is on, with %d recovery codes left. Use -disable to turn it off.\n", n)
+		}
+		return err
+	}
+
+	enrollment, err := a.store.BeginTOTP(username)
+	if err != nil {
+		return err
+	}
+	qr, err := totpQR(enrollment)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Scan this code with your authenticator app:")
+	fmt.Println(qr)
+	fmt.Printf("or enter the key %s\n\n", enrollment.Secret)
+	code, err := readLine("Code shown by the app: ")
+	if err != nil {
+		return err
+	}
+	codes, err := a.store.ConfirmTOTP(username, code)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Two-factor authentication is on. Keep these recovery codes somewhere safe;")
+	fmt.Println("each can be used once instead of a code if you lose the app:")
+	for _, c := range codes {
+		fmt.Println("  " + c)
+	}
+	return nil
+}
+
+// totpQR renders the enrollment URI as a QR code made of terminal characters.
+func totpQR(e persistence.TOTPEnrollment) (string, error) {
+	qr, err := qrcode.New(e.URI, qrcode.Low)
+	if err != nil {
+		return "", err
+	}
+	return qr.ToSmallString(false), nil
+}
@@ -0,0 +1,310 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// FileName is the name of the config file inside the application directory.
+const FileName = "config.toml"
+
+// Column names accepted in the [board] section.
+const (
+	ColumnTodo       = "todo"
+	ColumnInProgress = "in_progress"
+	ColumnDone       = "done"
+)
+
+// Border styles accepted in the [theme] section.
+var borderStyles = []string{"rounded", "normal", "thick", "double", "block", "hidden"}
+
+// colorPattern matches the colors lipgloss understands: an ANSI index (0-255)
+// or a hex color.
+var colorPattern = regexp.MustCompile(`^([0-9]{1,3}|#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6})$`)
+
+// Config holds the user settings read from the config file.
+type Config struct {
+	// Keys rebinds board actions, e.g. `new = ["n", "a"]`.
+	Keys     map[string][]string `toml:"keys"`
+	Theme    Theme               `toml:"theme"`
+	Board    Board               `toml:"board"`
+	Export   Export              `toml:"export"`
+	TodoTxt  TodoTxt             `toml:"todotxt"`
+	ICal     ICal                `toml:"ical"`
+	Security Security            `toml:"security"`
+	Password Password            `toml:"password"`
+}
+
+// Theme selects a built-in theme and optionally overrides its colors and
+// border style. Empty values keep the theme's own.
+type Theme struct {
+	Name    string `toml:"name"`    // auto, dark, light, high-contrast or no-color
+	Accent  string `toml:"accent"`  // border of the focused column
+	Spinner string `toml:"spinner"` // spinner shown while submitting
+	Error   string `toml:"error"`   // error messages
+	Border  string `toml:"border"`  // border style of the focused column
+}
+
+// Board holds the board layout settings.
+type Board struct {
+	// DefaultColumn is the column focused when the board opens.
+	DefaultColumn string `toml:"default_column"`
+	// Columns maps a column name to its title.
+	Columns map[string]string `toml:"columns"`
+	// Open maps a username to the owner of the board opened when they sign
+	// in, instead of asking which one when boards are shared with them.
+	Open map[string]string `toml:"open"`
+}
+
+// Export holds the settings of the export action.
+type Export struct {
+	// Dir is where the board export action writes its files. Empty means
+	// the exports directory next to the database.
+	Dir string `toml:"dir"`
+}
+
+// TodoTxt holds the todo.txt sync settings.
+type TodoTxt struct {
+	// Sync maps a username to the todo.txt file kept in sync with their
+	// board when it is opened and saved.
+	Sync map[string]string `toml:"sync"`
+}
+
+// ICal holds the calendar export settings.
+type ICal struct {
+	// Files maps a username to the .ics file regenerated every time their
+	// board is saved.
+	Files map[string]string `toml:"files"`
+	// Events adds a VEVENT on the due date of open tasks.
+	Events bool `toml:"events"`
+}
+
+// Security holds the account protection settings.
+type Security struct {
+	// Encrypt encrypts the tasks of every account with a key unlocked by its
+	// password. Existing accounts are encrypted the next time they sign in.
+	Encrypt bool `toml:"encrypt"`
+	// MaxAttempts is the number of failed sign-ins allowed before a username
+	// is locked out. Before that, each failure doubles the wait before the
+	// next attempt, starting at a second.
+	MaxAttempts int `toml:"max_attempts"`
+	// Lockout is how long the first lockout lasts, e.g. "15m"; it doubles
+	// with every further failure.
+	Lockout time.Duration `toml:"lockout"`
+	// SessionTTL is how long "remember me" keeps a user signed in.
+	SessionTTL time.Duration `toml:"session_ttl"`
+}
+
+// Password holds the password policy and how passwords are hashed.
+type Password struct {
+	MinLength int `toml:"min_length"`
+	// Require lists the character classes a password must contain: lower,
+	// upper, digit and symbol.
+	Require []string `toml:"require"`
+	// Blocklist rejects frequently used passwords.
+	Blocklist bool `toml:"blocklist"`
+	// Algorithm hashes new passwords: bcrypt or argon2id. Passwords hashed
+	// otherwise are rehashed when their user next signs in.
+	Algorithm  string `toml:"algorithm"`
+	BcryptCost int    `toml:"bcrypt_cost"`
+}
+
+// Password character classes and hashing algorithms accepted in the
+// [password] section.
+var (
+	passwordClasses    = []string{"lower", "upper", "digit", "symbol"}
+	passwordAlgorithms = []string{"bcrypt", "argon2id"}
+)
+
+// Default returns the built-in settings.
+func Default() Config {
+	return Config{
+		Keys: map[string][]string{},
+		Theme: Theme{
+			Name: "auto",
+		},
+		Board: Board{
+			DefaultColumn: ColumnTodo,
+			Columns: map[string]string{
+				ColumnTodo:       "To Do",
+				ColumnInProgress: "In Progress",
+				ColumnDone:       "Done",
+			},
+		},
+		Security: Security{
+			MaxAttempts: 5,
+			Lockout:     15 * time.Minute,
+			SessionTTL:  30 * 24 * time.Hour,
+		},
+		Password: Password{
+			MinLength:  6,
+			Blocklist:  true,
+			Algorithm:  "bcrypt",
+			BcryptCost: 10,
+		},
+	}
+}
+
+// DefaultPath returns the config file path inside baseDir. The TODO_ELM_CONFIG
+// environment variable overrides it.
+func DefaultPath(baseDir string) string {
+	if p := os.Getenv("TODO_ELM_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(baseDir, FileName)
+}
+
+// Load reads the config file at path on top of the defaults.
+// A missing file is not an error; the defaults are returned.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	md, err := toml.Decode(string(data), &cfg)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return cfg, fmt.Errorf("%s: %s", path, perr.ErrorWithPosition())
+		}
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cfg.Export.Dir = expandHome(cfg.Export.Dir)
+	for user, path := range cfg.TodoTxt.Sync {
+		cfg.TodoTxt.Sync[user] = expandHome(path)
+	}
+	for user, path := range cfg.ICal.Files {
+		cfg.ICal.Files[user] = expandHome(path)
+	}
+
+	var errs []error
+	for _, k := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("unknown setting %q", k.String()))
+	}
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid config %s:\n%w", path, errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+// validate checks the values that do not depend on other packages. Key
+// bindings are checked by the package that owns the actions.
+func (c Config) validate() []error {
+	var errs []error
+	colors := []struct{ name, value string }{
+		{"theme.accent", c.Theme.Accent},
+		{"theme.spinner", c.Theme.Spinner},
+		{"theme.error", c.Theme.Error},
+	}
+	for _, col := range colors {
+		if col.value != "" && !validColor(col.value) {
+			errs = append(errs, fmt.Errorf("%s: invalid color %q (want 0-255 or #rrggbb)", col.name, col.value))
+		}
+	}
+	if c.Theme.Border != "" && !slices.Contains(borderStyles, c.Theme.Border) {
+		errs = append(errs, fmt.Errorf("theme.border: unknown style %q (want one of %s)",
+			c.Theme.Border, strings.Join(borderStyles, ", ")))
+	}
+
+	columns := []string{ColumnTodo, ColumnInProgress, ColumnDone}
+	if !slices.Contains(columns, c.Board.DefaultColumn) {
+		errs = append(errs, fmt.Errorf("board.default_column: unknown column %q (want one of %s)",
+			c.Board.DefaultColumn, strings.Join(columns, ", ")))
+	}
+	for name, title := range c.Board.Columns {
+		if !slices.Contains(columns, name) {
+			errs = append(errs, fmt.Errorf("board.columns.%s: unknown column (want one of %s)",
+				name, strings.Join(columns, ", ")))
+			continue
+		}
+		if strings.TrimSpace(title) == "" {
+			errs = append(errs, fmt.Errorf("board.columns.%s: title cannot be empty", name))
+		}
+	}
+	for user, owner := range c.Board.Open {
+		if owner == "" {
+			errs = append(errs, fmt.Errorf("board.open.%s: owner cannot be empty", user))
+		}
+	}
+	for user, path := range c.TodoTxt.Sync {
+		if path == "" {
+			errs = append(errs, fmt.Errorf("todotxt.sync.%s: path cannot be empty", user))
+		}
+	}
+	for user, path := range c.ICal.Files {
+		if path == "" {
+			errs = append(errs, fmt.Errorf("ical.files.%s: path cannot be empty", user))
+		}
+	}
+	if c.Security.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("security.max_attempts: must be at least 1"))
+	}
+	if c.Security.Lockout <= 0 {
+		errs = append(errs, fmt.Errorf("security.lockout: must be a positive duration such as \"15m\""))
+	}
+	if c.Security.SessionTTL <= 0 {
+		errs = append(errs, fmt.Errorf("security.session_ttl: must be a positive duration such as \"720h\""))
+	}
+	if c.Password.MinLength < 1 {
+		errs = append(errs, fmt.Errorf("password.min_length: must be at least 1"))
+	}
+	for _, class := range c.Password.Require {
+		if !slices.Contains(passwordClasses, class) {
+			errs = append(errs, fmt.Errorf("password.require: unknown character class %q (want one of %s)",
+				class, strings.Join(passwordClasses, ", ")))
+		}
+	}
+	if !slices.Contains(passwordAlgorithms, c.Password.Algorithm) {
+		errs = append(errs, fmt.Errorf("password.algorithm: unknown algorithm %q (want one of %s)",
+			c.Password.Algorithm, strings.Join(passwordAlgorithms, ", ")))
+	}
+	if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+		errs = append(errs, fmt.Errorf("password.bcrypt_cost: must be between 4 and 31"))
+	}
+	for action, ks := range c.Keys {
+		if len(ks) == 0 {
+			errs = append(errs, fmt.Errorf("keys.%s: at least one key is required", action))
+		}
+	}
+	return errs
+}
+
+func validColor(s string) bool {
+	if !colorPattern.MatchString(s) {
+		return false
+	}
+	if s[0] != '#' {
+		n, err := strconv.Atoi(s)
+		return err == nil && n <= 255
+	}
+	return true
+}
+
+// expandHome replaces a leading "~/" with the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// daemonSocketName is the socket, inside the application directory, the
+// daemon listens on. daemonTokenName is the file it keeps its admin token
+// in, which todo-elm reads to administer the database through it.
+const (
+	daemonSocketName = "daemon.sock"
+	daemonTokenName  = "daemon.token"
+)
+
+func daemonSocketPath(baseDir string) string {
+	return filepath.Join(baseDir, daemonSocketName)
+}
+
+func daemonTokenPath(baseDir string) string {
+	return filepath.Join(baseDir, daemonTokenName)
+}
+
+// administer makes the connection to the daemon of baseDir that of an
+// administrator: whoever can open the database is one, see runAdmin.
+func administer(store *persistence.RemoteStore, baseDir string) error {
+	token, err := os.ReadFile(daemonTokenPath(baseDir))
+	if err == nil {
+		err = store.Admin(string(token))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to the daemon as administrator: %w", err)
+	}
+	return nil
+}
+
+// runDaemon keeps the database open and serves it to the board, the
+// commands and editors over the daemon socket, until interrupted. They use
+// the daemon instead of opening the database themselves while it runs.
+func runDaemon(a *app, args []string) error {
+	fs := newFlagSet("daemon")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	store, err := openStore(a.baseDir, a.cfg, a.readOnly)
+	if errors.Is(err, persistence.ErrInUse) {
+		if remote, derr := persistence.DialStore(daemonSocketPath(a.baseDir)); derr == nil {
+			remote.Close()
+			return errors.New("a daemon is already running")
+		}
+		return fmt.Errorf("%w; try again once it has quit", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to initialize persistence store: %w", err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Printf("Error closing persistence store: %v", err)
+		}
+	}()
+
+	// Written before anyone can connect, and left behind by a daemon that
+	// did not quit cleanly: it is replaced by the next one
+	token := rand.Text()
+	tokenPath := daemonTokenPath(a.baseDir)
+	if err := os.WriteFile(tokenPath, []byte(token), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(tokenPath)
+
+	path := daemonSocketPath(a.baseDir)
+	ln, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+	srv := persistence.NewRPCServer(store, token)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ln)
+	}()
+	log.Printf("Serving the database on %s", path)
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-errs:
+	case <-done:
+		log.Printf("Stopping")
+	}
+	if cerr := srv.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Only one process at a time can open the database. The one that does, the
+// board in a terminal or serve, listens on a Unix socket in the application
+// directory, and a todo-elm started meanwhile attaches to it: it runs the
+// board of the first process in its own terminal, see attach.
+//
+// The attaching process sends frames: a kind byte, the length of the
+// payload as a 4-byte big-endian integer, then the payload. The first frame
+// is the size of its terminal. The listening process sends back what the
+// board writes to the terminal and closes the connection when it quits.
+
+// instanceSocketName is the socket, inside the application directory, the
+// process that has the database open listens on.
+const instanceSocketName = "todo-elm.sock"
+
+const (
+	frameInput  = 'i' // keys typed, as read from the terminal
+	frameResize = 'r' // width and height of the terminal, 2 bytes each
+
+	maxFrameSize = 64 << 10
+)
+
+func instanceSocketPath(baseDir string) string {
+	return filepath.Join(baseDir, instanceSocketName)
+}
+
+// ownsDatabase reports whether store is the database opened by this process
+// for writing, which other processes then attach to. A read-only store may
+// be a copy of the database of a process listening already.
+func ownsDatabase(store persistence.Backend) bool {
+	s, ok := store.(*persistence.Store)
+	return ok && !s.ReadOnly()
+}
+
+// listenUnix listens on a Unix socket at path that only the user can
+// connect to. It must be called with the database open: any socket left at
+// path by a process that did not quit cleanly is removed, as nobody else
+// can be listening.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	header := make([]byte, 5, 5+len(payload))
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes is too large", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func resizeFrame(width, height int) []byte {
+	var payload [4]byte
+	binary.BigEndian.PutUint16(payload[:2], uint16(width))
+	binary.BigEndian.PutUint16(payload[2:], uint16(height))
+	return payload[:]
+}
+
+// instanceServer runs the board for the processes attaching to this one.
+type instanceServer struct {
+	ln      net.Listener
+	store   persistence.Backend
+	baseDir string
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	programs map[*tea.Program]bool
+	closing  bool
+	wg       sync.WaitGroup
+}
+
+// listenInstance listens for processes attaching to this one, which must
+// have the store of baseDir open. Close stops it.
+func listenInstance(store persistence.Backend, baseDir string, ttl time.Duration) (*instanceServer, error) {
+	ln, err := listenUnix(instanceSocketPath(baseDir))
+	if err != nil {
+		return nil, err
+	}
+	s := &instanceServer{
+		ln:       ln,
+		store:    store,
+		baseDir:  baseDir,
+		ttl:      ttl,
+		programs: map[*tea.Program]bool{},
+	}
+	go s.serve()
+	return s, nil
+}
+
+func (s *instanceServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle runs the board for one attached process until either quits.
+func (s *instanceServer) handle(conn net.Conn) {
+	defer conn.Close()
+	input, typed := io.Pipe()
+	rc := &remoteConn{}
+	m := initialModel(s.store, sessionPath(s.baseDir), s.ttl)
+	m.conn = rc
+	p := tea.NewProgram(m,
+		tea.WithInput(input),
+		tea.WithOutput(conn),
+		tea.WithAltScreen(),
+		tea.WithoutSignalHandler(),
+	)
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return
+	}
+	s.programs[p] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer typed.Close()
+		r := bufio.NewReader(conn)
+		for {
+			kind, payload, err := readFrame(r)
+			if err != nil {
+				// Detached
+				p.Kill()
+				return
+			}
+			switch kind {
+			case frameInput:
+				if _, err := typed.Write(payload); err != nil {
+					return
+				}
+			case frameResize:
+				if len(payload) == 4 {
+					p.Send(tea.WindowSizeMsg{
+						Width:  int(binary.BigEndian.Uint16(payload[:2])),
+						Height: int(binary.BigEndian.Uint16(payload[2:])),
+					})
+				}
+			}
+		}
+	}()
+	p.Run()
+
+	if username := rc.user(); username != "" {
+		s.store.Lock(username)
+	}
+	s.mu.Lock()
+	delete(s.programs, p)
+	closing := s.closing
+	s.mu.Unlock()
+	if closing {
+		fmt.Fprint(conn, "The todo-elm you were attached to has quit.\r\n")
+	}
+}
+
+// Close stops listening and quits the board of every attached process.
+func (s *instanceServer) Close() error {
+	s.mu.Lock()
+	s.closing = true
+	for p := range s.programs {
+		go p.Quit()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,134 @@
+package interchange
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// csvHeader is the first row of a CSV export, one task per following row.
+// Tags are separated by spaces and dates are written as YYYY-MM-DD.
+var csvHeader = []string{"board", "column", "id", "title", "description", "priority", "tags", "due"}
+
+func writeCSV(w io.Writer, doc Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			for _, t := range col.Tasks {
+				due := ""
+				if t.Due != nil {
+					due = t.Due.Format(todoTxtDate)
+				}
+				row := []string{b.Owner, col.Name, t.ID, t.Title, t.Description, t.Priority, strings.Join(t.Tags, " "), due}
+				if err := cw.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvFields are the task fields readCSV understands. Only the title is
+// required.
+var csvFields = []string{"title", "description", "column", "id", "priority", "tags", "due"}
+
+// readCSV reads one task per row. The first row is the header; opts.Mapping
+// says which headers hold the task fields.
+func readCSV(r io.Reader, opts ImportOptions) ([]persistence.Task, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	index := func(field string) int {
+		name := field
+		if m, ok := opts.Mapping[field]; ok {
+			name = m
+		}
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+		return -1
+	}
+	titleCol, descCol, statusCol := index("title"), index("description"), index("column")
+	idCol, priorityCol, tagsCol, dueCol := index("id"), index("priority"), index("tags"), index("due")
+	if titleCol < 0 {
+		return nil, fmt.Errorf("CSV has no %q column for the task title", mappedName(opts, "title"))
+	}
+	for field := range opts.Mapping {
+		if !slices.Contains(csvFields, field) {
+			return nil, fmt.Errorf("cannot map unknown field %q (want one of %s)", field, strings.Join(csvFields, ", "))
+		}
+		if index(field) < 0 {
+			return nil, fmt.Errorf("CSV has no %q column for the task %s", opts.Mapping[field], field)
+		}
+	}
+
+	var tasks []persistence.Task
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return rec[i]
+		}
+		t := persistence.Task{
+			ID:          strings.TrimSpace(field(idCol)),
+			Status:      opts.Column,
+			Title:       strings.TrimSpace(field(titleCol)),
+			Description: field(descCol),
+			Priority:    strings.ToUpper(strings.TrimSpace(field(priorityCol))),
+			Tags:        strings.Fields(field(tagsCol)),
+		}
+		if t.Title == "" {
+			return nil, fmt.Errorf("line %d: empty title", line)
+		}
+		if len(t.Priority) > 1 || (t.Priority != "" && (t.Priority[0] < 'A' || t.Priority[0] > 'Z')) {
+			return nil, fmt.Errorf("line %d: invalid priority %q (want A-Z)", line, t.Priority)
+		}
+		if v := strings.TrimSpace(field(dueCol)); v != "" {
+			d, err := time.Parse(todoTxtDate, v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid due date %q (want YYYY-MM-DD)", line, v)
+			}
+			t.Due = &d
+		}
+		if v := field(statusCol); strings.TrimSpace(v) != "" {
+			status, ok := opts.columnByName(v)
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown column %q", line, v)
+			}
+			t.Status = status
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+func mappedName(opts ImportOptions, field string) string {
+	if m, ok := opts.Mapping[field]; ok {
+		return m
+	}
+	return field
+}
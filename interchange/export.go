@@ -0,0 +1,158 @@
+package interchange
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// Format identifies an export file format.
+type Format string
+
+const (
+	JSON     Format = "json"
+	CSV      Format = "csv"
+	Markdown Format = "md"
+	TodoTxt  Format = "txt"
+	ICal     Format = "ics" // export only
+	// Taskwarrior is Taskwarrior's JSON export. Its files end in .json like
+	// JSON ones, so it is only chosen by name.
+	Taskwarrior Format = "taskwarrior"
+)
+
+// Formats lists the formats written by ExportAll.
+var Formats = []Format{JSON, CSV, Markdown, TodoTxt}
+
+// DocumentVersion is the version of the JSON document layout.
+const DocumentVersion = 1
+
+// Document is a full-fidelity snapshot of a user's boards.
+type Document struct {
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+	Boards   []Board   `json:"boards"`
+}
+
+// Board holds the columns of one board.
+type Board struct {
+	Owner   string   `json:"owner"`
+	Columns []Column `json:"columns"`
+}
+
+// Column holds the tasks of one column, in board order.
+type Column struct {
+	Name  string             `json:"name"` // persistence.TaskStatus.String()
+	Title string             `json:"title"`
+	Tasks []persistence.Task `json:"tasks"`
+}
+
+// ParseFormat returns the format named by s.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "json":
+		return JSON, nil
+	case "csv":
+		return CSV, nil
+	case "md", "markdown":
+		return Markdown, nil
+	case "txt", "todotxt", "todo.txt":
+		return TodoTxt, nil
+	case "ics", "ical":
+		return ICal, nil
+	case "taskwarrior", "tw":
+		return Taskwarrior, nil
+	}
+	return "", fmt.Errorf("unknown format %q (want json, csv, md, txt, ics or taskwarrior)", s)
+}
+
+// FormatFromPath returns the format matching the extension of path.
+func FormatFromPath(path string) (Format, error) {
+	return ParseFormat(filepath.Ext(path))
+}
+
+// LoadDocument reads the boards of username from the store. titles maps a
+// column name to its title; columns without a title use their name.
+func LoadDocument(store persistence.Backend, username string, titles map[string]string) (Document, error) {
+	return LoadBoardDocument(store, username, username, titles)
+}
+
+// LoadBoardDocument reads the board of owner on behalf of username, who must
+// own it or have it shared with them.
+func LoadBoardDocument(store persistence.Backend, username, owner string, titles map[string]string) (Document, error) {
+	board := Board{Owner: owner}
+	for _, status := range persistence.Statuses {
+		tasks, err := store.LoadBoardTasks(username, owner, status)
+		if err != nil {
+			return Document{}, fmt.Errorf("failed to load %s tasks: %w", status, err)
+		}
+		title := titles[status.String()]
+		if title == "" {
+			title = status.String()
+		}
+		board.Columns = append(board.Columns, Column{Name: status.String(), Title: title, Tasks: tasks})
+	}
+	return Document{
+		Version:  DocumentVersion,
+		Exported: time.Now().UTC().Truncate(time.Second),
+		Boards:   []Board{board},
+	}, nil
+}
+
+// Write encodes doc to w in the given format.
+func Write(w io.Writer, format Format, doc Document) error {
+	switch format {
+	case JSON:
+		return writeJSON(w, doc)
+	case CSV:
+		return writeCSV(w, doc)
+	case Markdown:
+		return writeMarkdown(w, doc)
+	case TodoTxt:
+		return writeTodoTxt(w, doc)
+	case ICal:
+		return WriteICal(w, doc, ICalOptions{})
+	case Taskwarrior:
+		return writeTaskwarrior(w, doc)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// WriteFile writes doc to path, choosing the format from its extension.
+func WriteFile(path string, doc Document) error {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := Write(f, format, doc); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// ExportAll writes doc in every format to dir, naming the files after the
+// user and the export time. It returns the paths written.
+func ExportAll(dir, username string, doc Document) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory %s: %w", dir, err)
+	}
+	base := fmt.Sprintf("%s-%s", username, doc.Exported.Local().Format("20060102-150405"))
+	var paths []string
+	for _, format := range Formats {
+		path := filepath.Join(dir, base+"."+string(format))
+		if err := WriteFile(path, doc); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
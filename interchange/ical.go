@@ -0,0 +1,162 @@
+package interchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// ICalOptions controls the calendar written by WriteICal.
+type ICalOptions struct {
+	// Events adds an all-day VEVENT on the due date of every open task, for
+	// calendar apps that do not show to-dos.
+	Events bool
+}
+
+const icalStamp = "20060102T150405Z"
+
+// icalStatus maps the board columns onto VTODO statuses.
+var icalStatus = map[persistence.TaskStatus]string{
+	persistence.Todo:       "NEEDS-ACTION",
+	persistence.InProgress: "IN-PROCESS",
+	persistence.Done:       "COMPLETED",
+}
+
+// WriteICal writes the tasks of doc that have a due date as an iCalendar
+// (RFC 5545) file with one VTODO per task.
+func WriteICal(w io.Writer, doc Document, opts ICalOptions) error {
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	stamp := icalStampOf(doc).Format(icalStamp)
+
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//ReggieReo//todo-elm//EN")
+	iw.line("CALSCALE:GREGORIAN")
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			for _, t := range col.Tasks {
+				if t.Due == nil {
+					continue
+				}
+				status, _ := persistence.ParseTaskStatus(col.Name)
+				iw.todo(t, status, stamp)
+				if opts.Events && status != persistence.Done {
+					iw.event(t, stamp)
+				}
+			}
+		}
+	}
+	iw.line("END:VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// icalStampOf returns the DTSTAMP of the calendar of doc: the latest time a
+// task was created or completed, so that the calendar only changes when
+// the tasks do. Tasks without times give the Unix epoch.
+func icalStampOf(doc Document) time.Time {
+	stamp := time.Unix(0, 0)
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			for _, t := range col.Tasks {
+				for _, at := range []*time.Time{t.Created, t.Completed} {
+					if at != nil && at.After(stamp) {
+						stamp = *at
+					}
+				}
+			}
+		}
+	}
+	return stamp.UTC()
+}
+
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icalWriter) todo(t persistence.Task, status persistence.TaskStatus, stamp string) {
+	iw.line("BEGIN:VTODO")
+	iw.line("UID:" + t.ID + "@todo-elm")
+	iw.line("DTSTAMP:" + stamp)
+	if t.Created != nil {
+		iw.line("CREATED:" + t.Created.UTC().Format(icalStamp))
+	}
+	iw.line("SUMMARY:" + icalText(t.Title))
+	if t.Description != "" {
+		iw.line("DESCRIPTION:" + icalText(t.Description))
+	}
+	iw.line("DUE;VALUE=DATE:" + t.Due.Format("20060102"))
+	iw.line("STATUS:" + icalStatus[status])
+	if status == persistence.Done {
+		iw.line("PERCENT-COMPLETE:100")
+		if t.Completed != nil {
+			iw.line("COMPLETED:" + t.Completed.UTC().Format(icalStamp))
+		}
+	}
+	if t.Priority != "" {
+		// A-I map onto 1-9 (1 is highest); later letters are lowest.
+		iw.line(fmt.Sprintf("PRIORITY:%d", min(int(t.Priority[0]-'A')+1, 9)))
+	}
+	if len(t.Tags) > 0 {
+		cats := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			cats[i] = icalText(tag)
+		}
+		iw.line("CATEGORIES:" + strings.Join(cats, ","))
+	}
+	iw.line("END:VTODO")
+}
+
+func (iw *icalWriter) event(t persistence.Task, stamp string) {
+	iw.line("BEGIN:VEVENT")
+	iw.line("UID:" + t.ID + "-due@todo-elm")
+	iw.line("DTSTAMP:" + stamp)
+	iw.line("SUMMARY:" + icalText("Due: "+t.Title))
+	iw.line("DTSTART;VALUE=DATE:" + t.Due.Format("20060102"))
+	iw.line("DTEND;VALUE=DATE:" + t.Due.AddDate(0, 0, 1).Format("20060102"))
+	iw.line("TRANSP:TRANSPARENT")
+	iw.line("END:VEVENT")
+}
+
+// line writes a content line, folded at 75 octets as RFC 5545 requires,
+// without splitting UTF-8 sequences.
+func (iw *icalWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if _, iw.err = iw.w.WriteString(s[:cut] + "\r\n "); iw.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = 74 // the leading space counts
+	}
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// WriteICalFile writes the calendar to path through a temporary file so
+// calendar apps watching it never read a partial file.
+func WriteICalFile(path string, doc Document, opts ICalOptions) error {
+	var sb strings.Builder
+	if err := WriteICal(&sb, doc, opts); err != nil {
+		return err
+	}
+	return writeFileIfChanged(path, []byte(sb.String()))
+}
@@ -0,0 +1,54 @@
+package interchange
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+func icalDocument(exported time.Time) Document {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	completed := time.Date(2026, 3, 2, 17, 30, 0, 0, time.UTC)
+	due := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	return Document{
+		Version:  DocumentVersion,
+		Exported: exported,
+		Boards: []Board{{Owner: "alice", Columns: []Column{
+			{Name: persistence.Todo.String(), Tasks: []persistence.Task{{ID: "a", Title: "plan", Due: &due, Created: &created}}},
+			{Name: persistence.InProgress.String()},
+			{Name: persistence.Done.String(), Tasks: []persistence.Task{{ID: "b", Title: "shop", Due: &due, Created: &created, Completed: &completed}}},
+		}}},
+	}
+}
+
+func TestWriteICalStable(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := WriteICal(&first, icalDocument(time.Now()), ICalOptions{Events: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteICal(&second, icalDocument(time.Now().Add(time.Hour)), ICalOptions{Events: true}); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("the calendar changed with the export time:\n%s\n%s", first.String(), second.String())
+	}
+	if !strings.Contains(first.String(), "DTSTAMP:20260302T173000Z\r\n") {
+		t.Errorf("DTSTAMP is not the latest task change:\n%s", first.String())
+	}
+}
+
+func TestExportAllWritesNoCalendar(t *testing.T) {
+	paths, err := ExportAll(t.TempDir(), "alice", icalDocument(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if filepath.Ext(path) == ".ics" {
+			t.Errorf("ExportAll wrote %s", path)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package interchange
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// ImportOptions controls how Read interprets a file.
+type ImportOptions struct {
+	Format Format
+	// Titles maps a column name to its title, so headings and CSV values
+	// can name a column by either.
+	Titles map[string]string
+	// Mapping maps a task field (title, description, column) to the CSV
+	// header holding it. Unmapped fields use a header named like the field.
+	Mapping map[string]string
+	// Column is where tasks go when the file does not say.
+	Column persistence.TaskStatus
+}
+
+// Read decodes the tasks in r. Each task's Status is the column it belongs
+// to.
+func Read(r io.Reader, opts ImportOptions) ([]persistence.Task, error) {
+	switch opts.Format {
+	case JSON:
+		return readJSON(r)
+	case CSV:
+		return readCSV(r, opts)
+	case Markdown:
+		return readMarkdown(r, opts)
+	case TodoTxt:
+		return readTodoTxt(r)
+	case Taskwarrior:
+		return readTaskwarrior(r)
+	case ICal:
+		return nil, fmt.Errorf("importing %s files is not supported", opts.Format)
+	}
+	return nil, fmt.Errorf("unknown format %q", opts.Format)
+}
+
+// columnByName returns the column named s, matching the column names and
+// titles case-insensitively.
+func (o ImportOptions) columnByName(s string) (persistence.TaskStatus, bool) {
+	s = strings.TrimSpace(s)
+	for _, status := range persistence.Statuses {
+		if strings.EqualFold(s, status.String()) || strings.EqualFold(s, o.Titles[status.String()]) {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+// Plan is the outcome of comparing imported tasks with a board: the tasks
+// that would be added and those skipped as duplicates.
+type Plan struct {
+	Add        []persistence.Task
+	Duplicates []persistence.Task
+}
+
+// PlanImport compares incoming with the tasks already on the board. A task
+// is a duplicate when a task with the same ID, or the same title ignoring
+// case and spacing, is already on the board or earlier in incoming.
+func PlanImport(existing []persistence.Task, incoming []persistence.Task) Plan {
+	seen := make(map[string]bool, len(existing))
+	ids := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		seen[dedupKey(t)] = true
+		ids[t.ID] = true
+	}
+	var p Plan
+	for _, t := range incoming {
+		k := dedupKey(t)
+		if seen[k] || (t.ID != "" && ids[t.ID]) {
+			p.Duplicates = append(p.Duplicates, t)
+			continue
+		}
+		seen[k] = true
+		ids[t.ID] = true
+		p.Add = append(p.Add, t)
+	}
+	return p
+}
+
+func dedupKey(t persistence.Task) string {
+	return strings.ToLower(singleLine(t.Title))
+}
+
+// LoadBoardTasks returns every task on the board of username.
+func LoadBoardTasks(store persistence.Backend, username string) ([]persistence.Task, error) {
+	var all []persistence.Task
+	for _, status := range persistence.Statuses {
+		tasks, err := store.LoadTasks(username, status)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s tasks: %w", status, err)
+		}
+		all = append(all, tasks...)
+	}
+	return all, nil
+}
+
+// Apply appends the planned tasks to the end of their columns.
+func (p Plan) Apply(store persistence.Backend, username string) error {
+	for _, status := range persistence.Statuses {
+		var add []persistence.Task
+		for _, t := range p.Add {
+			if t.Status == status {
+				add = append(add, t)
+			}
+		}
+		if len(add) == 0 {
+			continue
+		}
+		tasks, err := store.LoadTasks(username, status)
+		if err != nil {
+			return fmt.Errorf("failed to load %s tasks: %w", status, err)
+		}
+		if err := store.SaveTasks(username, status, append(tasks, add...)); err != nil {
+			return fmt.Errorf("failed to save %s tasks: %w", status, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package interchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+func writeJSON(w io.Writer, doc Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// readJSON reads the tasks of every board in an exported Document.
+func readJSON(r io.Reader) ([]persistence.Task, error) {
+	var doc Document
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Value == "array" && typeErr.Field == "" {
+			return nil, fmt.Errorf("not a todo-elm export; for a Taskwarrior export use -format taskwarrior")
+		}
+		return nil, fmt.Errorf("invalid JSON export: %w", err)
+	}
+	if doc.Version > DocumentVersion {
+		return nil, fmt.Errorf("export version %d is newer than supported version %d", doc.Version, DocumentVersion)
+	}
+	var tasks []persistence.Task
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			status, err := persistence.ParseTaskStatus(col.Name)
+			if err != nil {
+				return nil, fmt.Errorf("board %s: %w", b.Owner, err)
+			}
+			for _, t := range col.Tasks {
+				t.Status = status
+				tasks = append(tasks, t)
+			}
+		}
+	}
+	return tasks, nil
+}
@@ -0,0 +1,100 @@
+package interchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// writeMarkdown writes a heading per board and per column, and a checklist
+// item per task. Tasks in the done column are checked. Descriptions follow
+// their item, indented so they stay part of it.
+func writeMarkdown(w io.Writer, doc Document) error {
+	bw := bufio.NewWriter(w)
+	for i, b := range doc.Boards {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "# %s\n", b.Owner)
+		for _, col := range b.Columns {
+			fmt.Fprintf(bw, "\n## %s\n\n", col.Title)
+			if len(col.Tasks) == 0 {
+				fmt.Fprintln(bw, "_No tasks._")
+				continue
+			}
+			for _, t := range col.Tasks {
+				check := " "
+				if col.Name == persistence.Done.String() {
+					check = "x"
+				}
+				fmt.Fprintf(bw, "- [%s] %s\n", check, singleLine(t.Title))
+				if t.Description != "" {
+					for _, line := range strings.Split(t.Description, "\n") {
+						fmt.Fprintf(bw, "  %s\n", line)
+					}
+				}
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	itemPattern    = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+)
+
+// readMarkdown reads checklist items as tasks. A heading naming a column
+// (by name or title) puts the items below it in that column; other headings
+// are ignored. Checked items always go to the done column. Indented lines
+// right below an item are its description.
+func readMarkdown(r io.Reader, opts ImportOptions) ([]persistence.Task, error) {
+	var tasks []persistence.Task
+	column := opts.Column
+	var current *persistence.Task
+	var desc []string
+
+	flush := func() {
+		if current != nil {
+			current.Description = strings.Join(desc, "\n")
+			tasks = append(tasks, *current)
+		}
+		current, desc = nil, nil
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			if status, ok := opts.columnByName(m[2]); ok {
+				column = status
+			}
+			continue
+		}
+		if m := itemPattern.FindStringSubmatch(line); m != nil {
+			flush()
+			t := persistence.Task{Status: column, Title: strings.TrimSpace(m[2])}
+			if m[1] != " " {
+				t.Status = persistence.Done
+			}
+			current = &t
+			continue
+		}
+		if current != nil && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) {
+			desc = append(desc, strings.TrimPrefix(strings.TrimPrefix(line, "  "), "\t"))
+			continue
+		}
+		flush()
+	}
+	flush()
+	return tasks, sc.Err()
+}
@@ -0,0 +1,214 @@
+package interchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// twTime is the date format of Taskwarrior's JSON.
+const twTime = "20060102T150405Z"
+
+// twTask is a task in Taskwarrior's JSON export format. Only the attributes
+// with a counterpart on the board are kept.
+type twTask struct {
+	UUID        string         `json:"uuid"`
+	Description string         `json:"description"`
+	Status      string         `json:"status"`
+	Entry       string         `json:"entry,omitempty"`
+	Modified    string         `json:"modified,omitempty"`
+	Start       string         `json:"start,omitempty"`
+	End         string         `json:"end,omitempty"`
+	Due         string         `json:"due,omitempty"`
+	Project     string         `json:"project,omitempty"`
+	Priority    string         `json:"priority,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Annotations []twAnnotation `json:"annotations,omitempty"`
+}
+
+type twAnnotation struct {
+	Entry       string `json:"entry"`
+	Description string `json:"description"`
+}
+
+// Priorities map between Taskwarrior's H/M/L and the board's letters.
+var (
+	twToPriority = map[string]string{"H": "A", "M": "B", "L": "C"}
+	twPriorities = []string{"H", "M", "L"}
+)
+
+// writeTaskwarrior writes every task of doc as a Taskwarrior JSON array,
+// which `task import` accepts.
+//
+// Done tasks are completed, tasks in progress are pending and started, and
+// the rest are pending. The first "+project" tag becomes the project and
+// the description becomes an annotation.
+func writeTaskwarrior(w io.Writer, doc Document) error {
+	now := doc.Exported.UTC().Format(twTime)
+	tasks := []twTask{}
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			status, err := persistence.ParseTaskStatus(col.Name)
+			if err != nil {
+				return err
+			}
+			for _, t := range col.Tasks {
+				tw := twTask{
+					UUID:        t.ID,
+					Description: singleLine(t.Title),
+					Status:      "pending",
+					Entry:       now,
+					Modified:    now,
+				}
+				if t.Created != nil {
+					tw.Entry = t.Created.UTC().Format(twTime)
+				}
+				switch status {
+				case persistence.InProgress:
+					tw.Start = tw.Entry
+				case persistence.Done:
+					tw.Status = "completed"
+					tw.End = now
+					if t.Completed != nil {
+						tw.End = t.Completed.UTC().Format(twTime)
+					}
+				}
+				if t.Due != nil {
+					d := t.Due
+					tw.Due = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local).UTC().Format(twTime)
+				}
+				if t.Priority != "" {
+					tw.Priority = twPriorities[min(int(t.Priority[0]-'A'), len(twPriorities)-1)]
+				}
+				for _, tag := range t.Tags {
+					if strings.HasPrefix(tag, "+") && tw.Project == "" {
+						tw.Project = tag[1:]
+						continue
+					}
+					tw.Tags = append(tw.Tags, tag)
+				}
+				if t.Description != "" {
+					tw.Annotations = []twAnnotation{{Entry: tw.Entry, Description: t.Description}}
+				}
+				tasks = append(tasks, tw)
+			}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tasks)
+}
+
+// readTaskwarrior reads a Taskwarrior export: a JSON array or one task per
+// line. Deleted tasks and recurring templates are skipped.
+func readTaskwarrior(r io.Reader) ([]persistence.Task, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var tws []twTask
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &tws); err != nil {
+			return nil, fmt.Errorf("invalid Taskwarrior export: %w", err)
+		}
+	} else {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(nil, 1<<20)
+		for line := 1; sc.Scan(); line++ {
+			text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sc.Text()), ","))
+			if text == "" {
+				continue
+			}
+			var tw twTask
+			if err := json.Unmarshal([]byte(text), &tw); err != nil {
+				return nil, fmt.Errorf("line %d: invalid Taskwarrior task: %w", line, err)
+			}
+			tws = append(tws, tw)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var tasks []persistence.Task
+	for i, tw := range tws {
+		if tw.Status == "deleted" || tw.Status == "recurring" {
+			continue
+		}
+		t, err := fromTaskwarrior(tw)
+		if err != nil {
+			return nil, fmt.Errorf("task %d (%s): %w", i+1, tw.UUID, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
+
+func fromTaskwarrior(tw twTask) (persistence.Task, error) {
+	t := persistence.Task{
+		ID:       tw.UUID,
+		Status:   persistence.Todo,
+		Title:    strings.TrimSpace(tw.Description),
+		Priority: twToPriority[tw.Priority],
+	}
+	if t.Title == "" {
+		return t, fmt.Errorf("empty description")
+	}
+	switch {
+	case tw.Status == "completed":
+		t.Status = persistence.Done
+	case tw.Start != "":
+		t.Status = persistence.InProgress
+	}
+
+	var err error
+	if t.Created, err = parseTWTime(tw.Entry); err != nil {
+		return t, err
+	}
+	if t.Completed, err = parseTWTime(tw.End); err != nil {
+		return t, err
+	}
+	due, err := parseTWTime(tw.Due)
+	if err != nil {
+		return t, err
+	}
+	if due != nil {
+		// Keep the date the user sees in Taskwarrior.
+		l := due.Local()
+		d := time.Date(l.Year(), l.Month(), l.Day(), 0, 0, 0, 0, time.UTC)
+		t.Due = &d
+	}
+
+	if tw.Project != "" {
+		t.Tags = append(t.Tags, "+"+tw.Project)
+	}
+	for _, tag := range tw.Tags {
+		if !slices.Contains(t.Tags, tag) {
+			t.Tags = append(t.Tags, tag)
+		}
+	}
+	var notes []string
+	for _, a := range tw.Annotations {
+		notes = append(notes, a.Description)
+	}
+	t.Description = strings.Join(notes, "\n")
+	return t, nil
+}
+
+func parseTWTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(twTime, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", s)
+	}
+	return &t, nil
+}
@@ -0,0 +1,168 @@
+package interchange
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// todo.txt extensions written and understood besides due:.
+const (
+	todoTxtID     = "id"
+	todoTxtStatus = "status" // status:in_progress marks tasks in that column
+	todoTxtDate   = "2006-01-02"
+)
+
+var (
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\) `)
+	todoTxtDatePfx  = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}) `)
+)
+
+// formatTodoTxt returns the todo.txt line for t. Tasks in the done column
+// are completed ("x"), tasks in progress carry status:in_progress, and the
+// task ID is kept in an id: extension so edits can be matched on sync.
+// Descriptions have no place in todo.txt and are left out.
+func formatTodoTxt(t persistence.Task) string {
+	var parts []string
+	if t.Status == persistence.Done {
+		parts = append(parts, "x")
+		if t.Completed != nil {
+			parts = append(parts, t.Completed.Format(todoTxtDate))
+		}
+	} else if t.Priority != "" {
+		parts = append(parts, "("+t.Priority+")")
+	}
+	if t.Created != nil {
+		parts = append(parts, t.Created.Format(todoTxtDate))
+	}
+	parts = append(parts, singleLine(t.Title))
+	words := strings.Fields(t.Title)
+	for _, tag := range t.Tags {
+		if (strings.HasPrefix(tag, "+") || strings.HasPrefix(tag, "@")) && !slices.Contains(words, tag) {
+			parts = append(parts, tag)
+		}
+	}
+	if t.Status == persistence.Done && t.Priority != "" {
+		parts = append(parts, "pri:"+t.Priority)
+	}
+	if t.Due != nil {
+		parts = append(parts, "due:"+t.Due.Format(todoTxtDate))
+	}
+	if t.Status == persistence.InProgress {
+		parts = append(parts, todoTxtStatus+":"+persistence.InProgress.String())
+	}
+	if t.ID != "" {
+		parts = append(parts, todoTxtID+":"+t.ID)
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseTodoTxt parses one todo.txt line. Projects and contexts stay in the
+// title and are also recorded as tags; the extensions this package writes
+// are removed from the title.
+func parseTodoTxt(line string) (persistence.Task, error) {
+	t := persistence.Task{Status: persistence.Todo}
+	rest := strings.TrimSpace(line)
+
+	if rest == "x" || strings.HasPrefix(rest, "x ") {
+		t.Status = persistence.Done
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "x"))
+		if m := todoTxtDatePfx.FindStringSubmatch(rest + " "); m != nil {
+			d, err := time.Parse(todoTxtDate, m[1])
+			if err != nil {
+				return t, fmt.Errorf("invalid completion date %q", m[1])
+			}
+			t.Completed = &d
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, m[1]))
+		}
+	} else if m := todoTxtPriority.FindStringSubmatch(rest + " "); m != nil {
+		t.Priority = m[1]
+		rest = strings.TrimSpace(rest[len(m[0])-1:])
+	}
+	if m := todoTxtDatePfx.FindStringSubmatch(rest + " "); m != nil {
+		d, err := time.Parse(todoTxtDate, m[1])
+		if err != nil {
+			return t, fmt.Errorf("invalid creation date %q", m[1])
+		}
+		t.Created = &d
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, m[1]))
+	}
+
+	var title []string
+	for _, word := range strings.Fields(rest) {
+		key, value, ok := strings.Cut(word, ":")
+		if ok && value != "" && !strings.Contains(key, "/") {
+			switch key {
+			case "due":
+				d, err := time.Parse(todoTxtDate, value)
+				if err != nil {
+					return t, fmt.Errorf("invalid due date %q", value)
+				}
+				t.Due = &d
+				continue
+			case todoTxtID:
+				t.ID = value
+				continue
+			case "pri":
+				if p := strings.ToUpper(value); len(p) == 1 && p[0] >= 'A' && p[0] <= 'Z' {
+					t.Priority = p
+					continue
+				}
+			case todoTxtStatus:
+				if t.Status != persistence.Done {
+					status, err := persistence.ParseTaskStatus(value)
+					if err != nil {
+						return t, err
+					}
+					t.Status = status
+				}
+				continue
+			}
+		}
+		if len(word) > 1 && (word[0] == '+' || word[0] == '@') && !slices.Contains(t.Tags, word) {
+			t.Tags = append(t.Tags, word)
+		}
+		title = append(title, word)
+	}
+	t.Title = strings.Join(title, " ")
+	if t.Title == "" {
+		return t, fmt.Errorf("empty task")
+	}
+	return t, nil
+}
+
+// readTodoTxt reads one task per non-empty line.
+func readTodoTxt(r io.Reader) ([]persistence.Task, error) {
+	var tasks []persistence.Task
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		t, err := parseTodoTxt(sc.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, sc.Err()
+}
+
+// writeTodoTxt writes every task of doc, one per line, in board order.
+func writeTodoTxt(w io.Writer, doc Document) error {
+	bw := bufio.NewWriter(w)
+	for _, b := range doc.Boards {
+		for _, col := range b.Columns {
+			for _, t := range col.Tasks {
+				fmt.Fprintln(bw, formatTodoTxt(t))
+			}
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,195 @@
+package interchange
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// todoTxtSyncState names the sync state kept in the store.
+const todoTxtSyncState = "todotxt"
+
+// SyncResult summarises a todo.txt sync.
+type SyncResult struct {
+	FromFile  int // tasks added, changed or removed on the board by the file
+	Conflicts int // tasks changed on both sides; the board's version was kept
+}
+
+// BoardChanged reports whether the sync modified the board.
+func (r SyncResult) BoardChanged() bool {
+	return r.FromFile > 0
+}
+
+// SyncTodoTxt reconciles the board of username with the todo.txt file at
+// path, then rewrites the file from the board.
+//
+// Tasks are matched by their id: extension and compared with their line as of
+// the previous sync: a side that still has the old line did not change it,
+// so the other side's change wins. When both sides changed a task the board
+// wins. Lines without an id are new tasks. Descriptions are not part of
+// todo.txt and are never touched by the file.
+func SyncTodoTxt(store persistence.Backend, username, path string) (SyncResult, error) {
+	var res SyncResult
+
+	board := map[persistence.TaskStatus][]persistence.Task{}
+	onBoard := map[string]bool{}
+	for _, status := range persistence.Statuses {
+		tasks, err := store.LoadTasks(username, status)
+		if err != nil {
+			return res, fmt.Errorf("failed to load %s tasks: %w", status, err)
+		}
+		board[status] = tasks
+		for _, t := range tasks {
+			onBoard[t.ID] = true
+		}
+	}
+
+	fileTasks, err := readTodoTxtFile(path)
+	if err != nil {
+		return res, err
+	}
+	inFile := map[string]persistence.Task{}
+	for i := range fileTasks {
+		if fileTasks[i].ID == "" {
+			fileTasks[i].ID = persistence.NewTaskID()
+		}
+		inFile[fileTasks[i].ID] = fileTasks[i]
+	}
+
+	base := map[string]string{}
+	if state, err := store.LoadSyncState(username, todoTxtSyncState); err != nil {
+		return res, err
+	} else if state != nil {
+		if err := json.Unmarshal(state, &base); err != nil {
+			return res, fmt.Errorf("invalid todo.txt sync state: %w", err)
+		}
+	}
+
+	merged := map[persistence.TaskStatus][]persistence.Task{}
+	for _, status := range persistence.Statuses {
+		for _, t := range board[status] {
+			line := formatTodoTxt(t)
+			old, synced := base[t.ID]
+			f, ok := inFile[t.ID]
+			switch {
+			case ok:
+				fileLine := formatTodoTxt(f)
+				switch {
+				case fileLine == line || fileLine == old:
+				case line == old:
+					t = applyTodoTxt(t, f)
+					res.FromFile++
+				default:
+					res.Conflicts++
+				}
+			case synced && line == old:
+				// Removed from the file and unchanged on the board.
+				res.FromFile++
+				continue
+			}
+			merged[t.Status] = append(merged[t.Status], t)
+		}
+	}
+	for _, f := range fileTasks {
+		if onBoard[f.ID] {
+			continue
+		}
+		if old, synced := base[f.ID]; synced && old == formatTodoTxt(f) {
+			// Removed from the board and unchanged in the file.
+			continue
+		}
+		merged[f.Status] = append(merged[f.Status], f)
+		res.FromFile++
+	}
+
+	if res.BoardChanged() {
+		for _, status := range persistence.Statuses {
+			if err := store.SaveTasks(username, status, merged[status]); err != nil {
+				return res, fmt.Errorf("failed to save %s tasks: %w", status, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	newBase := map[string]string{}
+	for _, status := range persistence.Statuses {
+		for _, t := range merged[status] {
+			line := formatTodoTxt(t)
+			newBase[t.ID] = line
+			buf.WriteString(line + "\n")
+		}
+	}
+	if err := writeFileIfChanged(path, buf.Bytes()); err != nil {
+		return res, err
+	}
+	state, err := json.Marshal(newBase)
+	if err != nil {
+		return res, err
+	}
+	return res, store.SaveSyncState(username, todoTxtSyncState, state)
+}
+
+// applyTodoTxt copies the fields todo.txt holds from f onto t.
+func applyTodoTxt(t, f persistence.Task) persistence.Task {
+	t.Status = f.Status
+	t.Title = f.Title
+	t.Priority = f.Priority
+	t.Tags = f.Tags
+	t.Due = f.Due
+	t.Created = f.Created
+	t.Completed = f.Completed
+	return t
+}
+
+// readTodoTxtFile reads the tasks in path; a missing file has none.
+func readTodoTxtFile(path string) ([]persistence.Task, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tasks, err := readTodoTxt(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tasks, nil
+}
+
+// writeFileIfChanged replaces path with data through a temporary file, unless
+// it already holds data.
+func writeFileIfChanged(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,228 @@
+package interchange
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newSyncTest returns a store with the user alice and the path of a
+// todo.txt file, not created yet.
+func newSyncTest(t *testing.T) (*persistence.Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := persistence.NewStore(filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	store.SetHashing(persistence.HashBcrypt, bcrypt.MinCost)
+	if _, err := store.CreateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	return store, filepath.Join(dir, "todo.txt")
+}
+
+func syncAlice(t *testing.T, store persistence.Backend, path string) SyncResult {
+	t.Helper()
+	res, err := SyncTodoTxt(store, "alice", path)
+	if err != nil {
+		t.Fatalf("SyncTodoTxt: %v", err)
+	}
+	return res
+}
+
+// boardTitles lists the titles of the tasks of alice in each column.
+func boardTitles(t *testing.T, store persistence.Backend) [][]string {
+	t.Helper()
+	var columns [][]string
+	for _, status := range persistence.Statuses {
+		tasks, err := store.LoadTasks("alice", status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles := []string{}
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		columns = append(columns, titles)
+	}
+	return columns
+}
+
+// fileLines returns the lines of path without their id: extension.
+func fileLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if i := strings.Index(line, " id:"); i >= 0 {
+			line = line[:i]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// editFile replaces old by new in path, or removes the line holding old if
+// new is empty.
+func editFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	found := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if strings.Contains(line, old) {
+			found = true
+			if new == "" {
+				continue
+			}
+			line = strings.Replace(line, old, new, 1)
+		}
+		lines = append(lines, line)
+	}
+	if !found {
+		t.Fatalf("%q not in the file:\n%s", old, data)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// editBoard changes the task of alice titled old in column status.
+func editBoard(t *testing.T, store persistence.Backend, status persistence.TaskStatus, old string, change func(*persistence.Task)) {
+	t.Helper()
+	tasks, err := store.LoadTasks("alice", status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range tasks {
+		if tasks[i].Title == old {
+			change(&tasks[i])
+			if err := store.SaveTasks("alice", status, tasks); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no task %q on the board", old)
+}
+
+func TestSyncTodoTxtFirstSync(t *testing.T) {
+	store, path := newSyncTest(t)
+	if err := store.SaveTasks("alice", persistence.Todo, []persistence.Task{{Title: "water plants", Description: "the ferns"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("(A) call mom @phone\nx buy milk\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res := syncAlice(t, store, path)
+	if res.FromFile != 2 || res.Conflicts != 0 {
+		t.Errorf("SyncTodoTxt = %+v, want 2 from the file", res)
+	}
+	want := [][]string{{"water plants", "call mom @phone"}, {}, {"buy milk"}}
+	if got := boardTitles(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("board = %v, want %v", got, want)
+	}
+	wantLines := []string{"water plants", "(A) call mom @phone", "x buy milk"}
+	if got := fileLines(t, path); !reflect.DeepEqual(got, wantLines) {
+		t.Errorf("file = %q, want %q", got, wantLines)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := syncAlice(t, store, path); res.BoardChanged() || res.Conflicts != 0 {
+		t.Errorf("second SyncTodoTxt = %+v, want no change", res)
+	}
+	if after, err := os.Stat(path); err != nil || !os.SameFile(info, after) {
+		t.Errorf("second SyncTodoTxt rewrote the file")
+	}
+}
+
+func TestSyncTodoTxtChanges(t *testing.T) {
+	store, path := newSyncTest(t)
+	tasks := []persistence.Task{
+		{Title: "edited in file", Description: "kept"},
+		{Title: "edited on board"},
+		{Title: "edited on both"},
+		{Title: "removed from file"},
+		{Title: "removed from board"},
+	}
+	if err := store.SaveTasks("alice", persistence.Todo, tasks); err != nil {
+		t.Fatal(err)
+	}
+	syncAlice(t, store, path)
+
+	editFile(t, path, "edited in file", "(B) changed in file +garden")
+	editFile(t, path, "edited on both", "both, file version")
+	editFile(t, path, "removed from file", "")
+	editBoard(t, store, persistence.Todo, "edited on board", func(task *persistence.Task) { task.Title = "changed on board" })
+	editBoard(t, store, persistence.Todo, "edited on both", func(task *persistence.Task) { task.Title = "both, board version" })
+	board, err := store.LoadTasks("alice", persistence.Todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveTasks("alice", persistence.Todo, board[:len(board)-1]); err != nil {
+		t.Fatal(err)
+	}
+
+	res := syncAlice(t, store, path)
+	if res.FromFile != 2 || res.Conflicts != 1 {
+		t.Errorf("SyncTodoTxt = %+v, want 2 from the file and 1 conflict", res)
+	}
+	want := [][]string{{"changed in file +garden", "changed on board", "both, board version"}, {}, {}}
+	if got := boardTitles(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("board = %v, want %v", got, want)
+	}
+	wantLines := []string{"(B) changed in file +garden", "changed on board", "both, board version"}
+	if got := fileLines(t, path); !reflect.DeepEqual(got, wantLines) {
+		t.Errorf("file = %q, want %q", got, wantLines)
+	}
+
+	board, err = store.LoadTasks("alice", persistence.Todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board[0].Description != "kept" || board[0].Priority != "B" || !reflect.DeepEqual(board[0].Tags, []string{"+garden"}) {
+		t.Errorf("task changed in the file = %+v", board[0])
+	}
+}
+
+func TestSyncTodoTxtMoves(t *testing.T) {
+	store, path := newSyncTest(t)
+	if err := store.SaveTasks("alice", persistence.Todo, []persistence.Task{{Title: "finish me"}, {Title: "start me"}}); err != nil {
+		t.Fatal(err)
+	}
+	syncAlice(t, store, path)
+
+	editFile(t, path, "finish me", "x finish me")
+	editFile(t, path, "start me", "start me status:in_progress")
+	if res := syncAlice(t, store, path); res.FromFile != 2 {
+		t.Errorf("SyncTodoTxt = %+v, want 2 from the file", res)
+	}
+	want := [][]string{{}, {"start me"}, {"finish me"}}
+	if got := boardTitles(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("board = %v, want %v", got, want)
+	}
+}
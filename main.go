@@ -2,19 +2,25 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/ReggieReo/todo-elm/config"
+	"github.com/ReggieReo/todo-elm/passwords"
 	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"github.com/ReggieReo/todo-elm/theme"
 	"github.com/ReggieReo/todo-elm/todolist"
 
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/ssh"
 )
 
 type uiState int
@@ -25,21 +31,63 @@ const (
 	signUp
 	submitting
 	authenticated
+	signInCode
+	account
+	changePassword
+	deleteAccount
+	enrollTOTP
+	recoveryCodes
+	disableTOTP
+	pickBoard
+	shareBoard
 )
 
-type authSuccessMsg struct{ username string }
+// inAccount reports whether s is the account menu or one of its forms.
+func (s uiState) inAccount() bool {
+	switch s {
+	case account, changePassword, deleteAccount, enrollTOTP, recoveryCodes, disableTOTP, pickBoard, shareBoard:
+		return true
+	}
+	return false
+}
+
+// signInRequest holds the sign-in form while the second factor is asked for.
+type signInRequest struct {
+	username, password string
+	code               string // authentication or recovery code, if required
+	remember           bool
+}
+
+// passwordPolicy is the policy new passwords must follow, from the config.
+var passwordPolicy passwords.Policy
+
+type authSuccessMsg struct {
+	username string
+	session  string // token of the remembered session, if any
+}
 type authErrMsg struct{ err error }
+type passwordChangedMsg struct{}
+type lockTickMsg struct{} // refreshes the lockout countdown
+type accountDeletedMsg struct{ username string }
 
 type model struct {
 	width, height int
 	state         uiState
 	form          *huh.Form
-	store         *persistence.Store
+	store         persistence.Backend
 	spinner       spinner.Model
 	board         tea.Model
 	err           error
 	username      string
 	opInProgress  string
+	notice        string // shown on the menu, e.g. after deleting an account
+	sessionFile   string
+	sessionTTL    time.Duration
+	session       string // token of the remembered session, if any
+	pending       signInRequest
+	enrollment    persistence.TOTPEnrollment
+	conn          *remoteConn   // of a model served over SSH or attached, nil otherwise
+	publicKey     ssh.PublicKey // the SSH client signed in with, if any
 }
 
 const titleStr = `
@@ -56,53 +104,122 @@ const titleStr = `
 
 // command for persistance
 // createUserCmd creates a tea.Cmd that attempts to save the user via the persistence store.
-func createUserCmd(store *persistence.Store, username, password string) tea.Cmd {
+func createUserCmd(store persistence.Backend, username, password string) tea.Cmd {
 	return func() tea.Msg {
-		err := store.CreateUser(username, password)
+		uname, err := store.CreateUser(username, password)
 		if err != nil {
 			return authErrMsg{err}
 		}
-		return authSuccessMsg{username: username}
+		return authSuccessMsg{username: uname}
 	}
 }
 
 // authenticateUserCmd creates a tea.Cmd that attempts to sign in the user via the persistence store.
-func authenticateUserCmd(store *persistence.Store, username, password string) tea.Cmd {
+// If req.remember is set, a session is started and its token saved to sessionFile.
+func authenticateUserCmd(store persistence.Backend, req signInRequest, sessionFile string, ttl time.Duration) tea.Cmd {
 	return func() tea.Msg {
-		uname, err := store.AuthenticateUser(username, password)
+		var uname string
+		var err error
+		if req.code != "" {
+			uname, err = store.AuthenticateUserWithCode(req.username, req.password, req.code)
+		} else {
+			uname, err = store.AuthenticateUser(req.username, req.password)
+		}
+		if err == persistence.ErrSecondFactorRequired {
+			return secondFactorMsg{}
+		}
 		if err != nil {
 			return authErrMsg{err} // e.g., "invalid username or password"
 		}
-		return authSuccessMsg{username: uname}
+		if !req.remember {
+			return authSuccessMsg{username: uname}
+		}
+		token, err := store.CreateSession(uname, ttl)
+		if err == nil {
+			err = writeSessionToken(sessionFile, token)
+		}
+		if err != nil {
+			log.Printf("Error remembering session: %v", err)
+			return authSuccessMsg{username: uname}
+		}
+		return authSuccessMsg{username: uname, session: token}
 	}
 }
 
-func createSignInForm() *huh.Form {
-	return huh.NewForm(
-		huh.NewGroup(
-			huh.NewInput().
-				Key("username").
-				Title("Username").
-				Placeholder("Enter your username").
-				Validate(func(s string) error {
-					if s == "" {
-						return errors.New("username cannot be empty")
-					}
-					return nil
-				}),
-			huh.NewInput().
-				Key("password").
-				Title("Password").
-				Placeholder("Enter your password").
-				EchoMode(huh.EchoModePassword).
-				Validate(func(s string) error {
-					if s == "" {
-						return errors.New("password cannot be empty")
-					}
-					return nil
-				}),
-		),
-	)
+// changePasswordCmd creates a tea.Cmd that changes the password of the signed in user.
+func changePasswordCmd(store persistence.Backend, username, oldPassword, newPassword string) tea.Cmd {
+	return func() tea.Msg {
+		if err := store.ChangePassword(username, oldPassword, newPassword); err != nil {
+			return authErrMsg{err}
+		}
+		return passwordChangedMsg{}
+	}
+}
+
+// deleteAccountCmd creates a tea.Cmd that deletes the signed in user.
+func deleteAccountCmd(store persistence.Backend, username, password string) tea.Cmd {
+	return func() tea.Msg {
+		if err := store.DeleteUser(username, password); err != nil {
+			return authErrMsg{err}
+		}
+		return accountDeletedMsg{username: username}
+	}
+}
+
+// lockTick schedules the next refresh of the lockout countdown.
+func lockTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return lockTickMsg{}
+	})
+}
+
+// validatePassword checks a new password.
+func validatePassword(s string) error {
+	return passwordPolicy.Check(s)
+}
+
+// passwordStrength describes the policy and rates the password being typed.
+func passwordStrength(password *string) func() string {
+	return func() string {
+		if *password == "" {
+			return "Use " + passwordPolicy.Describe() + "."
+		}
+		return "Strength: " + passwords.Meter(*password)
+	}
+}
+
+// createSignInForm asks for the username and password, and whether to
+// remember the session if remember is set.
+func createSignInForm(remember bool) *huh.Form {
+	fields := []huh.Field{
+		huh.NewInput().
+			Key("username").
+			Title("Username").
+			Placeholder("Enter your username").
+			Validate(func(s string) error {
+				if s == "" {
+					return errors.New("username cannot be empty")
+				}
+				return nil
+			}),
+		huh.NewInput().
+			Key("password").
+			Title("Password").
+			Placeholder("Enter your password").
+			EchoMode(huh.EchoModePassword).
+			Validate(func(s string) error {
+				if s == "" {
+					return errors.New("password cannot be empty")
+				}
+				return nil
+			}),
+	}
+	if remember {
+		fields = append(fields, huh.NewConfirm().
+			Key("remember").
+			Title("Remember me on this computer?"))
+	}
+	return huh.NewForm(huh.NewGroup(fields...)).WithTheme(theme.Current().Huh())
 }
 
 func createSignUpForm() *huh.Form {
@@ -114,22 +231,19 @@ func createSignUpForm() *huh.Form {
 				Title("Choose Username").
 				Placeholder("Enter a username").
 				Validate(func(s string) error {
-					if len(s) < 3 {
-						return errors.New("username must be at least 3 characters")
-					}
-					if strings.ContainsAny(s, " ") {
-						return errors.New("username cannot contain spaces")
-					}
-					return nil
+					_, err := persistence.NormalizeUsername(s)
+					return err
 				}),
 			huh.NewInput().
 				Key("password").
 				Title("Choose Password").
+				Value(&password).
+				DescriptionFunc(passwordStrength(&password), &password).
 				Placeholder("Enter a password").
 				EchoMode(huh.EchoModePassword).
 				Validate(func(s string) error {
-					if len(s) < 6 {
-						return errors.New("Password must be at least 6 characters.")
+					if err := validatePassword(s); err != nil {
+						return err
 					}
 					password = s // Store the password for the confirmation check
 					return nil
@@ -146,7 +260,7 @@ func createSignUpForm() *huh.Form {
 					return nil
 				}),
 		),
-	)
+	).WithTheme(theme.Current().Huh())
 }
 func createMenuForm() *huh.Form {
 	f := huh.NewForm(
@@ -156,24 +270,132 @@ func createMenuForm() *huh.Form {
 				Title("Welcome to TODO!!!").
 				Options(huh.NewOptions("Sign-in", "Sign-up")...),
 		),
-	)
+	).WithTheme(theme.Current().Huh())
 	return f
 }
 
-func initialModel(store *persistence.Store) model {
+func createAccountForm(twoFactor bool) *huh.Form {
+	totpOption := "Set up two-factor authentication"
+	if twoFactor {
+		totpOption = "Turn off two-factor authentication"
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[string]().
+				Key("accountOption").
+				Title("Account").
+				Options(huh.NewOptions("Share your board", "Change password", totpOption, "Delete account", "Back to board")...),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func createChangePasswordForm() *huh.Form {
+	var password string // Variable to store the new password for validation
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("oldPassword").
+				Title("Current Password").
+				Placeholder("Enter your current password").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if s == "" {
+						return errors.New("password cannot be empty")
+					}
+					return nil
+				}),
+			huh.NewInput().
+				Key("password").
+				Title("New Password").
+				Value(&password).
+				DescriptionFunc(passwordStrength(&password), &password).
+				Placeholder("Enter a new password").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if err := validatePassword(s); err != nil {
+						return err
+					}
+					password = s
+					return nil
+				}),
+			huh.NewInput().
+				Key("confirmPassword").
+				Title("Confirm New Password").
+				Placeholder("Enter the new password again").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if s != password {
+						return errors.New("passwords do not match")
+					}
+					return nil
+				}),
+			huh.NewConfirm().
+				Key("confirm").
+				Title("Change your password?").
+				Affirmative("Change").
+				Negative("Cancel"),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func createDeleteAccountForm(username string) *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("password").
+				Title("Password").
+				Placeholder("Enter your password").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if s == "" {
+						return errors.New("password cannot be empty")
+					}
+					return nil
+				}),
+			huh.NewConfirm().
+				Key("confirm").
+				Title(fmt.Sprintf("Delete %s and all of their tasks?", username)).
+				Description("This cannot be undone.").
+				Affirmative("Delete").
+				Negative("Cancel"),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func initialModel(store persistence.Backend, sessionFile string, sessionTTL time.Duration) model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	return model{
-		form:    createMenuForm(),
-		state:   menu,
-		store:   store,
-		spinner: s,
+	s.Style = theme.Current().SpinnerStyle()
+	m := model{
+		form:        createMenuForm(),
+		state:       menu,
+		store:       store,
+		spinner:     s,
+		sessionFile: sessionFile,
+		sessionTTL:  sessionTTL,
+		session:     readSessionToken(sessionFile),
+	}
+	if m.session != "" {
+		m.state = submitting
+		m.opInProgress = "resume"
 	}
+	if store.ReadOnly() {
+		// The remembered session still signs in, but is neither replaced
+		// nor revoked
+		m.sessionFile = ""
+	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(m.form.Init(), m.spinner.Tick, tea.EnterAltScreen)
+	cmds := []tea.Cmd{m.form.Init(), m.spinner.Tick, tea.EnterAltScreen}
+	if m.session != "" {
+		cmds = append(cmds, resumeSessionCmd(m.store, m.sessionFile, m.session))
+	}
+	if m.publicKey != nil {
+		cmds = append(cmds, authenticateKeyCmd(m.store, m.conn.client, m.publicKey))
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -181,33 +403,76 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// handle authenticated status
 	if m.state == authenticated {
-		// Check for 'b' key press to go back to sign-in
-		if keyMsg, ok := msg.(tea.KeyMsg); ok && keyMsg.String() == "b" {
+		// Check for the log out key to go back to sign-in
+		if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, todolist.LogOutKey()) {
 			m.state = menu
 			m.form = createMenuForm()
 			m.err = nil
 			m.board = nil
+			m.store.Lock(m.username)
+			m.conn.setUser("")
+			forgetSession(m.store, m.sessionFile, m.session)
+			m.session = ""
 			cmds = append(cmds, m.form.Init())
 			return m, tea.Batch(cmds...)
 		}
 
+		// Open the account menu or another board, unless a task is being edited
+		if _, onBoard := m.board.(*todolist.Board); onBoard {
+			// The board explains why a read-only store has no account menu
+			if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, todolist.AccountKey()) && !m.store.ReadOnly() {
+				return m.openAccountMenu()
+			}
+			if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, todolist.BoardsKey()) {
+				return m.openBoardPicker()
+			}
+		}
+
 		b, cmd := m.board.Update(msg)
 		m.board = b
 		cmds = append(cmds, cmd)
 		return m, tea.Batch(cmds...)
 	}
 
+	// The board keeps watching for changes while a menu is shown over it
+	if msg, ok := msg.(todolist.RefreshMsg); ok {
+		if m.board == nil {
+			return m, nil
+		}
+		b, cmd := m.board.Update(msg)
+		m.board = b
+		return m, cmd
+	}
+
+	// Count down a sign-in lockout every second until it ends
+	if _, ok := msg.(lockTickMsg); ok {
+		var locked *persistence.LockedError
+		if !errors.As(m.err, &locked) {
+			return m, nil
+		}
+		if time.Now().Before(locked.Until) {
+			return m, lockTick()
+		}
+		m.err = nil
+		return m, nil
+	}
+
+	if m.state.inAccount() {
+		return m.updateAccount(msg)
+	}
+
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
+		switch {
+		case key.Matches(msg, todolist.QuitKey()):
 			return m, tea.Quit
-		case "b":
+		case key.Matches(msg, todolist.LogOutKey()):
 			if m.state != menu {
 				m.state = menu
 				m.form = createMenuForm()
 				m.err = nil
 				m.opInProgress = ""
+				m.pending = signInRequest{}
 				cmds = append(cmds, m.form.Init())
 				return m, tea.Batch(cmds...)
 			}
@@ -219,25 +484,57 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case authSuccessMsg:
 		m.username = msg.username
+		m.conn.setUser(msg.username)
+		m.session = msg.session
+		m.pending = signInRequest{}
 		m.form = nil
 		m.err = nil
+		m.notice = ""
 		m.state = authenticated
 		m.opInProgress = ""
-		m.board = todolist.NewBoard(msg.username, m.store)
-		fakeResize := func() tea.Msg {
-			return tea.WindowSizeMsg{Width: m.width, Height: m.height}
-		}
-		return m, fakeResize
+		return m.openFirstBoard()
 
 	case authErrMsg:
 		m.err = msg.err
+		var locked *persistence.LockedError
+		if errors.As(msg.err, &locked) {
+			cmds = append(cmds, lockTick())
+		}
 		switch m.opInProgress {
 		case "signin":
 			m.state = signIn
-			m.form = createSignInForm() // Re-create the sign-in form
+			m.form = createSignInForm(m.sessionFile != "") // Re-create the sign-in form
+		case "signin-code":
+			if errors.Is(msg.err, persistence.ErrInvalidCode) {
+				m.state = signInCode
+				m.form = createCodeForm()
+			} else {
+				m.state = signIn
+				m.form = createSignInForm(m.sessionFile != "")
+				m.pending = signInRequest{}
+			}
+		case "totp-begin":
+			m.state = account
+			m.form = createAccountForm(false)
+		case "totp-confirm":
+			m.state = enrollTOTP
+			m.form = createEnrollTOTPForm(m.enrollment)
+		case "totp-disable":
+			m.state = disableTOTP
+			m.form = createDisableTOTPForm()
 		case "signup":
 			m.state = signUp
 			m.form = createSignUpForm()
+		case "passwd":
+			m.state = changePassword
+			m.form = createChangePasswordForm()
+		case "delete":
+			m.state = deleteAccount
+			m.form = createDeleteAccountForm(m.username)
+		case "share":
+			shares, _ := m.store.Shares(m.username)
+			m.state = shareBoard
+			m.form = createShareForm(shares)
 		default:
 			m.state = menu
 			m.form = createMenuForm()
@@ -248,6 +545,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, tea.Batch(cmds...)
 
+	case sessionInvalidMsg:
+		m.state = menu
+		m.opInProgress = ""
+		m.session = ""
+		m.notice = msg.err.Error()
+		return m, nil
+
 	case spinner.TickMsg:
 		var spinCmd tea.Cmd
 		// Only tick spinner if we are in the submitting state
@@ -256,10 +560,66 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, spinCmd)
 		}
 		return m, tea.Batch(cmds...)
+
+	case passwordChangedMsg:
+		// Changing the password revoked the remembered sessions
+		forgetSession(m.store, m.sessionFile, m.session)
+		m.session = ""
+		m.opInProgress = ""
+		if b, ok := m.board.(*todolist.Board); ok {
+			b.SetStatus("Password changed.")
+		}
+		return m.backToBoard()
+
+	case secondFactorMsg:
+		m.state = signInCode
+		m.form = createCodeForm()
+		m.opInProgress = ""
+		return m, m.form.Init()
+
+	case totpBeganMsg:
+		m.enrollment = msg.enrollment
+		m.state = enrollTOTP
+		m.form = createEnrollTOTPForm(msg.enrollment)
+		m.opInProgress = ""
+		return m, m.form.Init()
+
+	case totpEnabledMsg:
+		m.enrollment = persistence.TOTPEnrollment{}
+		m.state = recoveryCodes
+		m.form = createRecoveryCodesForm(msg.codes)
+		m.opInProgress = ""
+		return m, m.form.Init()
+
+	case boardSharedMsg:
+		m.opInProgress = ""
+		if b, ok := m.board.(*todolist.Board); ok {
+			b.SetStatus(msg.status)
+		}
+		return m.backToBoard()
+
+	case totpDisabledMsg:
+		m.opInProgress = ""
+		if b, ok := m.board.(*todolist.Board); ok {
+			b.SetStatus("Two-factor authentication is off.")
+		}
+		return m.backToBoard()
+
+	case accountDeletedMsg:
+		forgetSession(m.store, m.sessionFile, m.session)
+		m.session = ""
+		m.state = menu
+		m.form = createMenuForm()
+		m.board = nil
+		m.username = ""
+		m.conn.setUser("")
+		m.opInProgress = ""
+		m.notice = fmt.Sprintf("Account %s deleted.", msg.username)
+		return m, m.form.Init()
 	}
 
 	// form handling
-	if m.form != nil && (m.state == menu || m.state == signIn || m.state == signUp) {
+	if m.form != nil && (m.state == menu || m.state == signIn || m.state == signUp || m.state == signInCode) {
 		var newForm tea.Model // huh.Form implements tea.Model
 		newForm, formCmd := m.form.Update(msg)
 		if f, ok := newForm.(*huh.Form); ok {
@@ -275,7 +635,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					switch signOption {
 					case "Sign-in":
 						m.state = signIn
-						m.form = createSignInForm()
+						m.form = createSignInForm(m.sessionFile != "")
 						cmds = append(cmds, m.form.Init()) // Initialize the new form
 					case "Sign-up":
 						m.state = signUp
@@ -283,12 +643,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						cmds = append(cmds, m.form.Init()) // Initialize the new form
 					}
 				case signIn:
-					username := m.form.GetString("username")
-					password := m.form.GetString("password")
+					m.pending = signInRequest{
+						username: m.form.GetString("username"),
+						password: m.form.GetString("password"),
+						remember: m.form.GetBool("remember"),
+					}
 					m.state = submitting
 					m.opInProgress = "signin"
 					m.form = nil
-					cmds = append(cmds, m.spinner.Tick, authenticateUserCmd(m.store, username, password))
+					cmds = append(cmds, m.spinner.Tick, authenticateUserCmd(m.store, m.pending, m.sessionFile, m.sessionTTL))
+				case signInCode:
+					m.pending.code = m.form.GetString("code")
+					m.state = submitting
+					m.opInProgress = "signin-code"
+					m.form = nil
+					cmds = append(cmds, m.spinner.Tick, authenticateUserCmd(m.store, m.pending, m.sessionFile, m.sessionTTL))
 				case signUp:
 					username := m.form.GetString("username")
 					password := m.form.GetString("password")
@@ -304,31 +673,176 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-func (m model) View() string {
-	var viewContent string
-	footer := "\nPress 'q' to quit."
+// updateAccount handles the account menu and its forms, opened from the
+// board. The back key returns to the board.
+func (m model) updateAccount(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case msg.String() == "ctrl+c":
+			return m, tea.Quit
+		case key.Matches(msg, todolist.BackKey()):
+			return m.backToBoard()
+		}
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	}
+
+	newForm, cmd := m.form.Update(msg)
+	f, ok := newForm.(*huh.Form)
+	if !ok {
+		return m, cmd
+	}
+	m.form = f
+	switch m.form.State {
+	case huh.StateAborted:
+		return m.backToBoard()
+	case huh.StateCompleted:
+	default:
+		return m, cmd
+	}
+
+	m.err = nil
+	switch m.state {
+	case account:
+		switch m.form.GetString("accountOption") {
+		case "Share your board":
+			shares, err := m.store.Shares(m.username)
+			m.state = shareBoard
+			m.form = createShareForm(shares)
+			m.err = err
+			return m, m.form.Init()
+		case "Change password":
+			m.state = changePassword
+			m.form = createChangePasswordForm()
+			return m, m.form.Init()
+		case "Delete account":
+			m.state = deleteAccount
+			m.form = createDeleteAccountForm(m.username)
+			return m, m.form.Init()
+		case "Set up two-factor authentication":
+			m.state = submitting
+			m.opInProgress = "totp-begin"
+			m.form = nil
+			return m, tea.Batch(m.spinner.Tick, beginTOTPCmd(m.store, m.username))
+		case "Turn off two-factor authentication":
+			m.state = disableTOTP
+			m.form = createDisableTOTPForm()
+			return m, m.form.Init()
+		}
+		return m.backToBoard()
+	case pickBoard:
+		return m.switchBoard(m.form.GetString("board"))
+	case shareBoard:
+		member := m.form.GetString("member")
+		role := m.form.GetString("role")
+		m.state = submitting
+		m.opInProgress = "share"
+		m.form = nil
+		return m, tea.Batch(m.spinner.Tick, shareBoardCmd(m.store, m.username, member, role))
+	case enrollTOTP:
+		code := m.form.GetString("code")
+		m.state = submitting
+		m.opInProgress = "totp-confirm"
+		m.form = nil
+		return m, tea.Batch(m.spinner.Tick, confirmTOTPCmd(m.store, m.username, code))
+	case recoveryCodes:
+		if b, ok := m.board.(*todolist.Board); ok {
+			b.SetStatus("Two-factor authentication is on.")
+		}
+		return m.backToBoard()
+	case disableTOTP:
+		if !m.form.GetBool("confirm") {
+			return m.backToBoard()
+		}
+		password := m.form.GetString("password")
+		code := m.form.GetString("code")
+		m.state = submitting
+		m.opInProgress = "totp-disable"
+		m.form = nil
+		return m, tea.Batch(m.spinner.Tick, disableTOTPCmd(m.store, m.username, password, code))
+	case changePassword:
+		if !m.form.GetBool("confirm") {
+			return m.backToBoard()
+		}
+		oldPassword := m.form.GetString("oldPassword")
+		password := m.form.GetString("password")
+		m.state = submitting
+		m.opInProgress = "passwd"
+		m.form = nil
+		return m, tea.Batch(m.spinner.Tick, changePasswordCmd(m.store, m.username, oldPassword, password))
+	case deleteAccount:
+		if !m.form.GetBool("confirm") {
+			return m.backToBoard()
+		}
+		password := m.form.GetString("password")
+		m.state = submitting
+		m.opInProgress = "delete"
+		m.form = nil
+		return m, tea.Batch(m.spinner.Tick, deleteAccountCmd(m.store, m.username, password))
+	}
+	return m, cmd
+}
 
-	errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9")) // Red
+// openAccountMenu shows the account menu over the board.
+func (m model) openAccountMenu() (tea.Model, tea.Cmd) {
+	twoFactor, err := m.store.TOTPEnabled(m.username)
+	m.state = account
+	m.form = createAccountForm(twoFactor)
+	m.err = err
+	m.opInProgress = ""
+	return m, m.form.Init()
+}
 
-	if m.state != menu && m.state != submitting {
-		footer += " Press 'b' to go back."
+// backToBoard leaves the account menu.
+func (m model) backToBoard() (tea.Model, tea.Cmd) {
+	m.state = authenticated
+	m.form = nil
+	m.err = nil
+	return m, func() tea.Msg {
+		return tea.WindowSizeMsg{Width: m.width, Height: m.height}
+	}
+}
+
+func (m model) View() string {
+	var viewContent string
+	footer := fmt.Sprintf("\nPress '%s' to quit.", todolist.QuitKey().Keys()[0])
+
+	errorStyle := theme.Current().ErrorStyle()
+	m.spinner.Style = theme.Current().SpinnerStyle()
+
+	switch {
+	case m.state == menu || m.state == submitting:
+	case m.state.inAccount():
+		// Typing in the account forms doesn't quit
+		footer = fmt.Sprintf("\nPress '%s' to go back to the board.", todolist.BackKey().Keys()[0])
+	default:
+		footer += fmt.Sprintf(" Press '%s' to go back.", todolist.LogOutKey().Keys()[0])
 	}
 
 	// Prepare error string if an error exists
 	errorStr := ""
 	if m.err != nil {
 		errorStr = errorStyle.Render("Error: " + m.err.Error())
+	} else if m.notice != "" && m.state == menu {
+		errorStr = theme.Current().MutedStyle().Render(m.notice)
+	}
+
+	title := titleStr
+	if notice := todolist.ReadOnlyNotice(m.store); notice != "" {
+		title = lipgloss.JoinVertical(lipgloss.Center, titleStr, notice)
 	}
 
 	// Determine view content based on state
 	switch m.state {
-	case menu, signIn, signUp:
+	case menu, signIn, signUp, signInCode, account, changePassword, deleteAccount, enrollTOTP, recoveryCodes, disableTOTP, pickBoard, shareBoard:
 		formView := ""
 		if m.form != nil {
 			formView = m.form.View()
 		}
 		body := lipgloss.JoinVertical(lipgloss.Center,
-			titleStr,
+			title,
 			errorStr,
 			formView,
 			footer,
@@ -337,7 +851,7 @@ func (m model) View() string {
 
 	case submitting:
 		body := lipgloss.JoinVertical(lipgloss.Center,
-			titleStr,
+			title,
 			fmt.Sprintf("%s Submitting...", m.spinner.View()), // Show spinner
 			footer,
 		)
@@ -366,7 +880,51 @@ func main() {
 	}
 	dbBaseDir := filepath.Join(homeDir, ".todo-elm")
 
-	store, err := persistence.NewStore(dbBaseDir)
+	configPath := flag.String("config", config.DefaultPath(dbBaseDir), "path to the config file")
+	readOnly := flag.Bool("read-only", false, "open the database read-only, to browse and export without changing anything")
+	flag.Usage = usage
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := theme.Configure(cfg.Theme); err != nil {
+		log.Fatalf("invalid config %s:\ntheme.name: %v", *configPath, err)
+	}
+	if cfg.Export.Dir == "" {
+		cfg.Export.Dir = filepath.Join(dbBaseDir, "exports")
+	}
+	if err := todolist.Configure(cfg); err != nil {
+		log.Fatalf("invalid config %s:\n%v", *configPath, err)
+	}
+	passwordPolicy = passwords.FromConfig(cfg.Password)
+
+	if flag.NArg() > 0 {
+		err := runCommand(&app{baseDir: dbBaseDir, cfg: cfg, readOnly: *readOnly}, flag.Arg(0), flag.Args()[1:])
+		if err != nil {
+			if err != errUsage {
+				fmt.Fprintf(os.Stderr, "todo-elm %s: %v\n", flag.Arg(0), err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	store, err := connectStore(dbBaseDir, cfg, *readOnly)
+	if errors.Is(err, persistence.ErrInUse) {
+		// Already running: show its board here, or else a read-only copy of
+		// the database
+		aerr := attach(dbBaseDir)
+		if aerr == nil {
+			return
+		}
+		if !errors.Is(aerr, errNoInstance) {
+			log.Fatalf("Could not attach to the running todo-elm: %v", aerr)
+		}
+		log.Printf("%v; opening it read-only", err)
+		store, err = openStore(dbBaseDir, cfg, true)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize persistence store: %v", err)
 	}
@@ -376,8 +934,16 @@ func main() {
 			log.Printf("Error closing persistence store: %v", err)
 		}
 	}()
+	// Let todo-elm started meanwhile attach; closed before the store
+	if ownsDatabase(store) {
+		if inst, err := listenInstance(store, dbBaseDir, cfg.Security.SessionTTL); err != nil {
+			log.Printf("Warning: other terminals cannot attach to this one: %v", err)
+		} else {
+			defer inst.Close()
+		}
+	}
 
-	p := tea.NewProgram(initialModel(store), tea.WithAltScreen())
+	p := tea.NewProgram(initialModel(store, sessionPath(dbBaseDir), cfg.Security.SessionTTL), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		log.Fatal("Error running program:", err)
 	}
@@ -0,0 +1,119 @@
+// Package passwords checks new passwords against the configured policy and
+// rates their strength for the sign-up form.
+package passwords
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ReggieReo/todo-elm/config"
+)
+
+// Character classes a policy can require.
+const (
+	Lower  = "lower"
+	Upper  = "upper"
+	Digit  = "digit"
+	Symbol = "symbol"
+)
+
+//go:embed common.txt
+var commonList string
+
+var common = func() map[string]bool {
+	m := map[string]bool{}
+	for _, line := range strings.Split(commonList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			m[line] = true
+		}
+	}
+	return m
+}()
+
+// Policy is the set of rules new passwords must follow.
+type Policy struct {
+	MinLength int
+	Require   []string // character classes, see Lower, Upper, Digit and Symbol
+	Blocklist bool     // reject frequently used passwords
+}
+
+// FromConfig returns the policy of the [password] section.
+func FromConfig(cfg config.Password) Policy {
+	return Policy{MinLength: cfg.MinLength, Require: cfg.Require, Blocklist: cfg.Blocklist}
+}
+
+// Check returns an error describing the first rule password breaks.
+func (p Policy) Check(password string) error {
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	for _, class := range p.Require {
+		if !hasClass(password, class) {
+			return fmt.Errorf("password must contain %s", describeClass(class))
+		}
+	}
+	if p.Blocklist && IsCommon(password) {
+		return fmt.Errorf("password is too common")
+	}
+	return nil
+}
+
+// Describe summarizes the policy for prompts, e.g. "at least 8 characters,
+// with a digit".
+func (p Policy) Describe() string {
+	s := fmt.Sprintf("at least %d characters", p.MinLength)
+	var classes []string
+	for _, class := range p.Require {
+		classes = append(classes, describeClass(class))
+	}
+	if len(classes) > 0 {
+		s += ", with " + strings.Join(classes, ", ")
+	}
+	return s
+}
+
+// IsCommon reports whether password is one of the frequently used ones,
+// ignoring case and trailing digits and symbols ("Password123!").
+func IsCommon(password string) bool {
+	p := strings.ToLower(password)
+	if common[p] {
+		return true
+	}
+	p = strings.TrimRightFunc(p, func(r rune) bool {
+		return unicode.IsDigit(r) || isSymbol(r)
+	})
+	return p != "" && common[p]
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch {
+		case class == Lower && unicode.IsLower(r),
+			class == Upper && unicode.IsUpper(r),
+			class == Digit && unicode.IsDigit(r),
+			class == Symbol && isSymbol(r):
+			return true
+		}
+	}
+	return false
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+func describeClass(class string) string {
+	switch class {
+	case Lower:
+		return "a lower case letter"
+	case Upper:
+		return "an upper case letter"
+	case Digit:
+		return "a digit"
+	case Symbol:
+		return "a symbol"
+	}
+	return class
+}
@@ -0,0 +1,56 @@
+package passwords
+
+import "strings"
+
+// Strength levels returned by Rate.
+const (
+	VeryWeak = iota
+	Weak
+	Fair
+	Strong
+	VeryStrong
+)
+
+var strengthNames = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// Rate estimates the strength of password from its length and variety, from
+// VeryWeak to VeryStrong. It is a guide for the user, not a rule; the
+// policy decides what is accepted.
+func Rate(password string) int {
+	if password == "" || IsCommon(password) {
+		return VeryWeak
+	}
+	classes := 0
+	for _, class := range []string{Lower, Upper, Digit, Symbol} {
+		if hasClass(password, class) {
+			classes++
+		}
+	}
+	distinct := map[rune]bool{}
+	for _, r := range password {
+		distinct[r] = true
+	}
+
+	n := len([]rune(password))
+	score := 0
+	switch {
+	case n >= 16:
+		score = 3
+	case n >= 12:
+		score = 2
+	case n >= 8:
+		score = 1
+	}
+	score += classes - 1
+	if len(distinct) < n/2 {
+		score-- // mostly repeated characters
+	}
+	return max(VeryWeak, min(score, VeryStrong))
+}
+
+// Meter renders the strength of password as a bar and a name, e.g.
+// "■■■□□ fair".
+func Meter(password string) string {
+	r := Rate(password)
+	return strings.Repeat("■", r+1) + strings.Repeat("□", VeryStrong-r) + " " + strengthNames[r]
+}
@@ -0,0 +1,159 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// ChangePassword replaces the password of username after checking the
+// current one. The new password is hashed afresh and, for an encrypted
+// account, the data key is re-wrapped with it; the tasks are not touched.
+// Remembered sessions are revoked.
+//
+// Only the password is checked: the caller is expected to have signed the
+// user in, including any second factor.
+func (s *Store) ChangePassword(username, oldPassword, newPassword string) error {
+	// Also unlocks the data key, which rekey needs.
+	username, err := s.reauthenticate(username, oldPassword)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	return s.update(func(txn *badger.Txn) error {
+		if err := txn.Set(userKey(username), hashedPassword); err != nil {
+			return fmt.Errorf("failed saving user: %w", err)
+		}
+		if err := s.rekey(txn, username, newPassword); err != nil {
+			return fmt.Errorf("failed re-keying tasks: %w", err)
+		}
+		return deleteSessions(txn, username)
+	})
+}
+
+// DeleteUser removes username and everything stored for them after checking
+// their password. Like ChangePassword, it does not ask for a second factor.
+func (s *Store) DeleteUser(username, password string) error {
+	username, err := s.reauthenticate(username, password)
+	if err != nil {
+		return err
+	}
+	err = s.update(func(txn *badger.Txn) error {
+		keys, err := accountKeys(txn, username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return fmt.Errorf("failed deleting %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.forget(username)
+	return nil
+}
+
+// reauthenticate checks the password of a signed in user before a sensitive
+// change, and returns their stored name.
+func (s *Store) reauthenticate(username, password string) (string, error) {
+	username, done, err := s.checkPassword(username, password)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	return username, s.signIn(username, password)
+}
+
+// accountKeys returns every database key holding data of username.
+func accountKeys(txn *badger.Txn, username string) ([][]byte, error) {
+	keys := [][]byte{userKey(username), dataKeyKey(username), boxKeysKey(username), authFailKey(username), totpKey(username), disabledKey(username), revisionKey(username)}
+	keys = append(keys, dataKeys(txn, username)...)
+	sessions, err := sessionKeys(txn, username)
+	if err != nil {
+		return nil, err
+	}
+	shares, err := shareKeys(txn, username)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, authorizedKeyKeys(txn, username)...)
+	return append(append(keys, sessions...), shares...), nil
+}
+
+// renameUser moves everything stored for oldName to newName, including the
+// shares of their board and of the boards shared with them, keeping the
+// expiry of sessions and failed sign-ins.
+func renameUser(txn *badger.Txn, oldName, newName string) error {
+	keys, err := accountKeys(txn, oldName)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		newKey := renamedKey(key, oldName, newName)
+		switch {
+		case strings.HasPrefix(string(key), "session:"):
+			var sess Session
+			if err := json.Unmarshal(val, &sess); err != nil {
+				return fmt.Errorf("invalid session: %w", err)
+			}
+			sess.Username = newName
+			if val, err = json.Marshal(sess); err != nil {
+				return err
+			}
+		case strings.HasPrefix(string(key), "share:"):
+			var sh Share
+			if err := json.Unmarshal(val, &sh); err != nil {
+				return fmt.Errorf("invalid share: %w", err)
+			}
+			sh = renameShare(sh, oldName, newName)
+			newKey = shareKey(sh.Owner, sh.Member)
+			if val, err = json.Marshal(sh); err != nil {
+				return err
+			}
+		}
+		if string(newKey) != string(key) {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		e := badger.NewEntry(newKey, val)
+		e.ExpiresAt = item.ExpiresAt()
+		if err := txn.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renamedKey returns key of oldName as the same key of newName. Session keys
+// do not contain the username and are returned unchanged; share keys are
+// renamed by renameUser.
+func renamedKey(key []byte, oldName, newName string) []byte {
+	for _, prefix := range []string{"user:", "userkey:", "boxkey:", "authfail:", "totp:", "disabled:", "sshkey:", "rev:", "tasks:", "sync:"} {
+		rest, ok := strings.CutPrefix(string(key), prefix+oldName)
+		if ok && (rest == "" || rest[0] == ':') {
+			return []byte(prefix + newName + rest)
+		}
+	}
+	return key
+}
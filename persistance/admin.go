@@ -0,0 +1,297 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// The administration of users works on the store directly, without signing
+// them in: whoever can open the database is its administrator.
+
+// ErrAccountDisabled is returned when signing in to an account that was
+// disabled with SetDisabled. It is only returned for the right password.
+var ErrAccountDisabled = errors.New("account is disabled")
+
+// disabledKey generates the database key marking a user as disabled.
+func disabledKey(username string) []byte {
+	return []byte("disabled:" + username)
+}
+
+// UserInfo describes an account for administrators.
+type UserInfo struct {
+	Username  string
+	Encrypted bool // the tasks are encrypted, see EnableEncryption
+	TOTP      bool // two-factor authentication is enabled
+	Disabled  bool
+	Sessions  int // remembered sessions
+}
+
+// Users returns every user, sorted by name.
+func (s *Store) Users() ([]UserInfo, error) {
+	var users []UserInfo
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, name := range usernames(txn) {
+			info, err := userInfo(txn, name)
+			if err != nil {
+				return fmt.Errorf("failed reading %s: %w", name, err)
+			}
+			users = append(users, info)
+		}
+		return nil
+	})
+	return users, err
+}
+
+// User returns the account of username, or ErrUserNotFound.
+func (s *Store) User(username string) (UserInfo, error) {
+	var info UserInfo
+	err := s.db.View(func(txn *badger.Txn) error {
+		name, err := existingUser(txn, username)
+		if err != nil {
+			return err
+		}
+		info, err = userInfo(txn, name)
+		return err
+	})
+	return info, err
+}
+
+// ErrUserNotFound is returned by the administration of users for a
+// username that does not exist.
+var ErrUserNotFound = errors.New("user not found")
+
+// existingUser returns the stored name of the user named name, in its
+// canonical form or, for a legacy account, as it is.
+func existingUser(txn *badger.Txn, name string) (string, error) {
+	candidates := []string{name}
+	if canonical, err := NormalizeUsername(name); err == nil && canonical != name {
+		candidates = append([]string{canonical}, candidates...)
+	}
+	for _, c := range candidates {
+		_, err := txn.Get(userKey(c))
+		if err == nil {
+			return c, nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return "", fmt.Errorf("failed retrieving user: %w", err)
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUserNotFound, name)
+}
+
+// usernames returns the names of every user, sorted.
+func usernames(txn *badger.Txn) []string {
+	var names []string
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte("user:")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		names = append(names, strings.TrimPrefix(string(it.Item().Key()), "user:"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func userInfo(txn *badger.Txn, username string) (UserInfo, error) {
+	info := UserInfo{Username: username}
+	wk, err := readWrappedKey(txn, username)
+	if err != nil {
+		return info, err
+	}
+	info.Encrypted = wk != nil
+	st, err := readTOTP(txn, username)
+	if err != nil {
+		return info, err
+	}
+	info.TOTP = st != nil && st.Enabled
+	if info.Disabled, err = isDisabled(txn, username); err != nil {
+		return info, err
+	}
+	sessions, err := sessionKeys(txn, username)
+	info.Sessions = len(sessions)
+	return info, err
+}
+
+func isDisabled(txn *badger.Txn, username string) (bool, error) {
+	_, err := txn.Get(disabledKey(username))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetDisabled disables or enables the account of username. Disabling it
+// revokes its sessions; its tasks and shares are kept.
+func (s *Store) SetDisabled(username string, disabled bool) error {
+	err := s.update(func(txn *badger.Txn) error {
+		name, err := existingUser(txn, username)
+		if err != nil {
+			return err
+		}
+		username = name
+		if !disabled {
+			return txn.Delete(disabledKey(username))
+		}
+		if err := txn.Set(disabledKey(username), nil); err != nil {
+			return err
+		}
+		return deleteSessions(txn, username)
+	})
+	if err == nil && disabled {
+		s.forget(username)
+	}
+	return err
+}
+
+// ResetPassword sets a new password for username without the current one,
+// clearing their failed sign-ins and revoking their sessions. Two-factor
+// authentication is kept.
+//
+// The tasks of an encrypted account cannot be decrypted without the old
+// password, so they are deleted with its keys: the account starts over with
+// an empty board, encrypted again on the next sign in if encryption is
+// enabled. The boards shared with the user open again once their owners
+// have signed in. It returns whether the tasks were deleted.
+func (s *Store) ResetPassword(username, password string) (bool, error) {
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return false, fmt.Errorf("could not hash password: %w", err)
+	}
+	discarded := false
+	err = s.update(func(txn *badger.Txn) error {
+		name, err := existingUser(txn, username)
+		if err != nil {
+			return err
+		}
+		username = name
+		if err := txn.Set(userKey(username), hashedPassword); err != nil {
+			return fmt.Errorf("failed saving user: %w", err)
+		}
+		if err := txn.Delete(authFailKey(username)); err != nil {
+			return err
+		}
+		if err := deleteSessions(txn, username); err != nil {
+			return err
+		}
+		wk, err := readWrappedKey(txn, username)
+		if err != nil || wk == nil {
+			return err
+		}
+		discarded = true
+		return discardKeys(txn, username)
+	})
+	if err == nil {
+		s.forget(username)
+	}
+	return discarded, err
+}
+
+// discardKeys deletes the keys of an encrypted account with the data they
+// encrypt. The keys sealed to the account, and its own key sealed to the
+// members of its board, are dropped from the shares to be sealed again.
+func discardKeys(txn *badger.Txn, username string) error {
+	keys := [][]byte{dataKeyKey(username), boxKeysKey(username)}
+	keys = append(keys, dataKeys(txn, username)...)
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return fmt.Errorf("failed deleting %s: %w", key, err)
+		}
+	}
+	// Boards open elsewhere must not save the deleted tasks back
+	if _, err := bumpRevision(txn, username); err != nil {
+		return err
+	}
+	shares, err := readShares(txn, func(sh Share) bool {
+		return (sh.Owner == username || sh.Member == username) && len(sh.Key) > 0
+	})
+	if err != nil {
+		return err
+	}
+	for _, sh := range shares {
+		sh.Key = nil
+		if err := writeShare(txn, sh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteSessions(txn *badger.Txn, username string) error {
+	sessions, err := sessionKeys(txn, username)
+	if err != nil {
+		return err
+	}
+	for _, key := range sessions {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameUser renames the account oldName to newName, moving everything
+// stored for it, and returns the canonical form of newName. The user keeps
+// their password, sessions and shares. Tasks assigned to them keep the old
+// name until they are assigned again.
+func (s *Store) RenameUser(oldName, newName string) (string, error) {
+	newName, err := NormalizeUsername(newName)
+	if err != nil {
+		return "", err
+	}
+	err = s.update(func(txn *badger.Txn) error {
+		name, err := existingUser(txn, oldName)
+		if err != nil {
+			return err
+		}
+		oldName = name
+		if newName == oldName {
+			return nil
+		}
+		_, err = txn.Get(userKey(newName))
+		if err == nil {
+			return ErrUserExists
+		}
+		if err != badger.ErrKeyNotFound {
+			return fmt.Errorf("failed checking username: %w", err)
+		}
+		if confusableUser(txn, newName, oldName) != "" {
+			return ErrUsernameConfusable
+		}
+		return renameUser(txn, oldName, newName)
+	})
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if key, ok := s.keys[oldName]; ok {
+		s.keys[newName] = key
+	}
+	if n, ok := s.holds[oldName]; ok {
+		s.holds[newName] = n
+	}
+	delete(s.keys, oldName)
+	delete(s.holds, oldName)
+	s.mu.Unlock()
+	return newName, nil
+}
+
+// TaskCounts returns the number of tasks of each status on the board of
+// username. The tasks of an encrypted account can only be counted while
+// it is unlocked; ErrLocked is returned otherwise.
+func (s *Store) TaskCounts(username string) (map[TaskStatus]int, error) {
+	counts := map[TaskStatus]int{}
+	for _, status := range Statuses {
+		tasks, err := s.LoadTasks(username, status)
+		if err != nil {
+			return nil, err
+		}
+		counts[status] = len(tasks)
+	}
+	return counts, nil
+}
@@ -0,0 +1,75 @@
+package persistence
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Backend is what the board, the commands and the servers need of a store:
+// a *Store opened by this process, or a *RemoteStore using the store of a
+// daemon. Users signed in through it stay unlocked until Lock, or until it
+// is closed.
+type Backend interface {
+	Close() error
+	ReadOnly() bool
+	Snapshot() (time.Time, bool)
+
+	CreateUser(username, password string) (string, error)
+	AuthenticateUser(username, password string) (string, error)
+	AuthenticateUserWithCode(username, password, code string) (string, error)
+	Lock(username string)
+	ChangePassword(username, oldPassword, newPassword string) error
+	DeleteUser(username, password string) error
+
+	CreateSession(username string, ttl time.Duration) (string, error)
+	ResumeSession(token string) (string, error)
+	EndSession(token string) error
+	Sessions(username string) ([]Session, error)
+	RevokeSession(username, id string) (int, error)
+
+	TOTPEnabled(username string) (bool, error)
+	BeginTOTP(username string) (TOTPEnrollment, error)
+	ConfirmTOTP(username, code string) ([]string, error)
+	DisableTOTP(username, password, code string) error
+	RecoveryCodesLeft(username string) (int, error)
+
+	AddAuthorizedKey(username, line string) (AuthorizedKey, error)
+	AuthorizedKeys(username string) ([]AuthorizedKey, error)
+	RemoveAuthorizedKey(username, fingerprint string) error
+	KeyAuthorized(username string, pub ssh.PublicKey) (string, error)
+	AuthenticateKey(username string, pub ssh.PublicKey) (string, error)
+
+	SaveTasks(username string, status TaskStatus, tasks []Task) error
+	LoadTasks(username string, status TaskStatus) ([]Task, error)
+	SaveBoardTasks(username, owner string, status TaskStatus, tasks []Task) error
+	LoadBoardTasks(username, owner string, status TaskStatus) ([]Task, error)
+	LoadBoard(username, owner string) (BoardTasks, error)
+	SaveBoard(username, owner string, b BoardTasks) (uint64, error)
+	WaitBoard(ctx context.Context, owner string) error
+	SaveSyncState(username, name string, state []byte) error
+	LoadSyncState(username, name string) ([]byte, error)
+
+	ShareBoard(owner, member string, role Role) error
+	UnshareBoard(owner, member string) error
+	Shares(owner string) ([]Share, error)
+	Boards(username string) ([]BoardRef, error)
+	BoardMembers(owner string) ([]string, error)
+	BoardRole(username, owner string) (Role, error)
+	AssignedTasks(username string) ([]AssignedTask, error)
+
+	Users() ([]UserInfo, error)
+	User(username string) (UserInfo, error)
+	SetDisabled(username string, disabled bool) error
+	ResetPassword(username, password string) (bool, error)
+	RenameUser(oldName, newName string) (string, error)
+	TaskCounts(username string) (map[TaskStatus]int, error)
+	Backup(w io.Writer, compress bool) (BackupManifest, error)
+}
+
+var (
+	_ Backend = (*Store)(nil)
+	_ Backend = (*RemoteStore)(nil)
+)
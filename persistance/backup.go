@@ -0,0 +1,298 @@
+package persistence
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// A backup is a tar archive, optionally gzip-compressed, holding
+// backupManifestName followed by backupDataName, the output of Badger's
+// streaming backup.
+const (
+	backupManifestName = "manifest.json"
+	backupDataName     = "badger.bak"
+	backupApp          = "todo-elm"
+)
+
+// BackupManifest describes a backup.
+type BackupManifest struct {
+	App           string    `json:"app"`
+	SchemaVersion int       `json:"schema_version"`
+	Created       time.Time `json:"created"`
+	Users         int       `json:"users"`  // informational, counted next to the backup
+	Keys          int       `json:"keys"`   // informational, counted next to the backup
+	Size          int64     `json:"size"`   // bytes of backupDataName
+	SHA256        string    `json:"sha256"` // of backupDataName
+}
+
+// Backup writes a full backup of the open database to w, gzip-compressed if
+// compress is set, and returns its manifest.
+func (s *Store) Backup(w io.Writer, compress bool) (BackupManifest, error) {
+	m := BackupManifest{App: backupApp, Created: time.Now().UTC().Truncate(time.Second)}
+
+	// The tar header needs the size up front, so stage the data in a file.
+	tmp, err := os.CreateTemp("", "todo-elm-backup-*")
+	if err != nil {
+		return m, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err := s.db.Backup(io.MultiWriter(tmp, h), 0); err != nil {
+		return m, fmt.Errorf("failed to back up database: %w", err)
+	}
+	if m.Size, err = tmp.Seek(0, io.SeekCurrent); err != nil {
+		return m, err
+	}
+	m.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	err = s.db.View(func(txn *badger.Txn) error {
+		if m.SchemaVersion, err = readSchemaVersion(txn); err != nil {
+			return err
+		}
+		m.Keys, m.Users, err = countKeys(txn)
+		return err
+	})
+	if err != nil {
+		return m, err
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	if err := writeTarFile(tw, backupManifestName, int64(len(manifest)), strings.NewReader(string(manifest))); err != nil {
+		return m, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return m, err
+	}
+	if err := writeTarFile(tw, backupDataName, m.Size, tmp); err != nil {
+		return m, err
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	if gz != nil {
+		return m, gz.Close()
+	}
+	return m, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// countKeys returns the number of keys and of users in the database.
+func countKeys(txn *badger.Txn) (keys, users int, err error) {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys++
+		if strings.HasPrefix(string(it.Item().Key()), "user:") {
+			users++
+		}
+	}
+	return keys, users, nil
+}
+
+// Restore replaces the database in baseDir with the backup read from r.
+//
+// The backup is loaded into a staging database and checked first: its
+// manifest must be for a schema this build can open, its checksum must match,
+// and every key it holds must be readable. Only then is the live database
+// moved aside, to the returned path, and the staging one put in its place.
+// Restore fails if the live database is in use.
+func Restore(baseDir string, r io.Reader) (BackupManifest, string, error) {
+	m, data, err := readBackup(r)
+	if err != nil {
+		return m, "", err
+	}
+	defer os.Remove(data)
+
+	live := DBDir(baseDir)
+	stamp := time.Now().Format("20060102-150405")
+	staging := filepath.Join(baseDir, "badger.restore-"+stamp)
+	if err := loadStaging(staging, data, m); err != nil {
+		os.RemoveAll(staging)
+		return m, "", err
+	}
+
+	// Take the lock of the live database to make sure nothing uses it.
+	if _, err := os.Stat(live); err == nil {
+		db, err := badger.Open(badger.DefaultOptions(live).WithLogger(nil))
+		if err != nil {
+			os.RemoveAll(staging)
+			return m, "", fmt.Errorf("cannot open the live database, is todo-elm running? %w", err)
+		}
+		if err := db.Close(); err != nil {
+			os.RemoveAll(staging)
+			return m, "", err
+		}
+	}
+
+	previous := ""
+	if _, err := os.Stat(live); err == nil {
+		previous = filepath.Join(baseDir, "badger.before-restore-"+stamp)
+		if err := os.Rename(live, previous); err != nil {
+			os.RemoveAll(staging)
+			return m, "", fmt.Errorf("failed to move the live database aside: %w", err)
+		}
+	}
+	if err := os.Rename(staging, live); err != nil {
+		if previous != "" {
+			os.Rename(previous, live)
+		}
+		return m, "", fmt.Errorf("failed to put the restored database in place: %w", err)
+	}
+	return m, previous, nil
+}
+
+// ReadBackupManifest returns the manifest of the backup read from r after
+// checking the backup data against it.
+func ReadBackupManifest(r io.Reader) (BackupManifest, error) {
+	m, data, err := readBackup(r)
+	if data != "" {
+		os.Remove(data)
+	}
+	return m, err
+}
+
+// readBackup checks the archive read from r and extracts the database data
+// to a temporary file, whose path it returns.
+func readBackup(r io.Reader) (BackupManifest, string, error) {
+	var m BackupManifest
+
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return m, "", fmt.Errorf("invalid compressed backup: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return m, "", errors.New("not a todo-elm backup: missing manifest")
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, "", fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if m.App != backupApp {
+		return m, "", fmt.Errorf("not a todo-elm backup (app %q)", m.App)
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return m, "", fmt.Errorf("backup schema version %d is newer than supported version %d", m.SchemaVersion, SchemaVersion)
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != backupDataName {
+		return m, "", errors.New("invalid backup: missing database data")
+	}
+	tmp, err := os.CreateTemp("", "todo-elm-restore-*")
+	if err != nil {
+		return m, "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), tr)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && (n != m.Size || hex.EncodeToString(h.Sum(nil)) != m.SHA256) {
+		err = errors.New("backup data does not match its manifest checksum")
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return m, "", fmt.Errorf("invalid backup: %w", err)
+	}
+	return m, tmp.Name(), nil
+}
+
+// loadStaging creates a database in dir from the backup data and checks it
+// against the manifest.
+func loadStaging(dir, data string, m BackupManifest) error {
+	f, err := os.Open(data)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return fmt.Errorf("failed to create staging database: %w", err)
+	}
+	if err := db.Load(f, 256); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to load backup: %w", err)
+	}
+	err = db.View(func(txn *badger.Txn) error {
+		version, err := readSchemaVersion(txn)
+		if err != nil {
+			return err
+		}
+		if version != m.SchemaVersion {
+			return fmt.Errorf("restored schema version %d does not match manifest version %d", version, m.SchemaVersion)
+		}
+		return validateValues(txn)
+	})
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("backup failed validation: %w", err)
+	}
+	return nil
+}
+
+// validateValues checks that every value the store reads back decodes.
+// Encrypted values can only be checked by their owner and are skipped.
+func validateValues(txn *badger.Txn) error {
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("tasks:")})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		err := item.Value(func(val []byte) error {
+			if isEncrypted(val) {
+				return nil
+			}
+			var tasks []Task
+			return json.Unmarshal(val, &tasks)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", item.Key(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Every board has a revision, counting the saves of its tasks. Clients
+// load a board with its revision and save it back with SaveBoard, which
+// fails with a *ConflictError when someone else saved it in between, so
+// that changes are merged instead of overwritten.
+
+// ErrConflict is matched by a *ConflictError with errors.Is.
+var ErrConflict = errors.New("the board was changed by someone else")
+
+// ConflictError is returned by SaveBoard when the board was saved since the
+// revision the changes were made to.
+type ConflictError struct {
+	Owner    string
+	Revision uint64 // current revision of the board
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s's board was changed by someone else (now at revision %d)", e.Owner, e.Revision)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// BoardTasks holds the tasks of every column of a board at a revision.
+type BoardTasks struct {
+	Revision uint64
+	Columns  [][]Task // by TaskStatus, in board order
+}
+
+// revisionKey generates the database key for the revision of the board of
+// owner.
+func revisionKey(owner string) []byte {
+	return []byte("rev:" + owner)
+}
+
+// readRevision returns the revision of the board of owner; boards never
+// saved are at revision 0.
+func readRevision(txn *badger.Txn, owner string) (uint64, error) {
+	item, err := txn.Get(revisionKey(owner))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed retrieving revision: %w", err)
+	}
+	var rev uint64
+	err = item.Value(func(val []byte) error {
+		rev, err = strconv.ParseUint(string(val), 10, 64)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision: %w", err)
+	}
+	return rev, nil
+}
+
+// bumpRevision counts a save of the board of owner and returns its new
+// revision.
+func bumpRevision(txn *badger.Txn, owner string) (uint64, error) {
+	rev, err := readRevision(txn, owner)
+	if err != nil {
+		return 0, err
+	}
+	rev++
+	return rev, txn.Set(revisionKey(owner), []byte(strconv.FormatUint(rev, 10)))
+}
+
+// LoadBoard loads every column of the board of owner on behalf of username,
+// who must own the board or have it shared with them, with its revision.
+func (s *Store) LoadBoard(username, owner string) (BoardTasks, error) {
+	b := BoardTasks{Columns: make([][]Task, len(Statuses))}
+	err := s.db.View(func(txn *badger.Txn) error {
+		if _, err := boardRole(txn, username, owner); err != nil {
+			return err
+		}
+		var err error
+		if b.Revision, err = readRevision(txn, owner); err != nil {
+			return err
+		}
+		for _, status := range Statuses {
+			if b.Columns[status], err = s.readTasks(txn, username, owner, status); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return BoardTasks{}, err
+	}
+	return b, nil
+}
+
+// SaveBoard saves every column of the board of owner on behalf of username,
+// who must own the board or be one of its editors, and returns its new
+// revision. b.Revision must be the revision the changes were made to,
+// otherwise nothing is saved and a *ConflictError is returned. Tasks
+// without an ID are given one.
+func (s *Store) SaveBoard(username, owner string, b BoardTasks) (uint64, error) {
+	if len(b.Columns) != len(Statuses) {
+		return 0, fmt.Errorf("a board has %d columns, not %d", len(Statuses), len(b.Columns))
+	}
+	vals := make([][]byte, len(b.Columns))
+	for status, tasks := range b.Columns {
+		for i := range tasks {
+			if tasks[i].ID == "" {
+				tasks[i].ID = NewTaskID()
+			}
+		}
+		val, err := json.Marshal(tasks)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal tasks: %w", err)
+		}
+		vals[status] = val
+	}
+
+	var rev uint64
+	err := s.update(func(txn *badger.Txn) error {
+		role, err := boardRole(txn, username, owner)
+		if err != nil {
+			return err
+		}
+		if !role.CanWrite() {
+			return ErrPermissionDenied
+		}
+		current, err := readRevision(txn, owner)
+		if err != nil {
+			return err
+		}
+		if current != b.Revision {
+			return &ConflictError{Owner: owner, Revision: current}
+		}
+		for status, val := range vals {
+			sealed, err := s.sealValue(txn, username, owner, taskKey(owner, TaskStatus(status)), val)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(taskKey(owner, TaskStatus(status)), sealed); err != nil {
+				return err
+			}
+		}
+		rev, err = bumpRevision(txn, owner)
+		return err
+	})
+	if errors.Is(err, badger.ErrConflict) {
+		// Saved by someone else at the same time
+		conflict := &ConflictError{Owner: owner}
+		if err := s.db.View(func(txn *badger.Txn) error {
+			var err error
+			conflict.Revision, err = readRevision(txn, owner)
+			return err
+		}); err != nil {
+			return 0, err
+		}
+		return 0, conflict
+	}
+	return rev, err
+}
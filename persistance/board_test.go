@@ -0,0 +1,130 @@
+package persistence
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// boardWith returns a board at rev with one task titled title in Todo.
+func boardWith(rev uint64, title string) BoardTasks {
+	return BoardTasks{Revision: rev, Columns: [][]Task{{{Title: title}}, {}, {}}}
+}
+
+func TestSaveBoard(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+
+	rev, err := s.SaveBoard("alice", "alice", boardWith(0, "first"))
+	if err != nil || rev != 1 {
+		t.Fatalf("SaveBoard = %d, %v, want 1", rev, err)
+	}
+	b, err := s.LoadBoard("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Revision != 1 || len(b.Columns[Todo]) != 1 || b.Columns[Todo][0].Title != "first" || b.Columns[Todo][0].ID == "" {
+		t.Fatalf("LoadBoard = %+v", b)
+	}
+
+	if rev, err = s.SaveBoard("alice", "alice", boardWith(1, "second")); err != nil || rev != 2 {
+		t.Fatalf("SaveBoard = %d, %v, want 2", rev, err)
+	}
+}
+
+func TestSaveBoardStaleRevision(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	if _, err := s.SaveBoard("alice", "alice", boardWith(0, "first")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.SaveBoard("alice", "alice", boardWith(0, "stale"))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("SaveBoard at a stale revision = %v, want a *ConflictError", err)
+	}
+	if conflict.Owner != "alice" || conflict.Revision != 1 {
+		t.Errorf("conflict = %+v, want alice at revision 1", conflict)
+	}
+	b, err := s.LoadBoard("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Revision != 1 || b.Columns[Todo][0].Title != "first" {
+		t.Errorf("stale save changed the board: %+v", b)
+	}
+}
+
+func TestSaveBoardRoles(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	createUser(t, s, "bob")
+	createUser(t, s, "carol")
+	createUser(t, s, "dave")
+	if err := s.ShareBoard("alice", "bob", RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ShareBoard("alice", "carol", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SaveBoard("carol", "alice", boardWith(0, "viewer")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SaveBoard by a viewer = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := s.SaveBoard("dave", "alice", boardWith(0, "stranger")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SaveBoard by a stranger = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := s.LoadBoard("dave", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard by a stranger = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := s.SaveBoard("bob", "alice", boardWith(0, "editor")); err != nil {
+		t.Errorf("SaveBoard by an editor: %v", err)
+	}
+	b, err := s.LoadBoard("carol", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Revision != 1 || b.Columns[Todo][0].Title != "editor" {
+		t.Errorf("LoadBoard by a viewer = %+v", b)
+	}
+}
+
+func TestSaveBoardConcurrent(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+
+	const saves = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, saves)
+	for range saves {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.SaveBoard("alice", "alice", boardWith(0, "concurrent"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, ErrConflict):
+			t.Errorf("SaveBoard = %v, want nil or a conflict", err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("%d concurrent saves at the same revision succeeded, want 1", saved)
+	}
+	b, err := s.LoadBoard("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Revision != 1 {
+		t.Errorf("revision = %d, want 1", b.Revision)
+	}
+}
@@ -0,0 +1,409 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted accounts have a random data key that encrypts their task values
+// with AES-256-GCM. The data key is stored wrapped (encrypted) with a key
+// derived from the password, so it can only be unlocked by signing in, and a
+// password change only re-wraps it.
+
+// ErrLocked is returned when reading or writing the data of an encrypted
+// account whose key has not been unlocked by AuthenticateUser.
+var ErrLocked = errors.New("tasks are encrypted; sign in to unlock them")
+
+// encryptedMagic starts every encrypted value. JSON never starts with a NUL
+// byte, so plaintext values written before encryption stay readable. Values
+// starting with legacyMagic were sealed without associated data, see
+// valueAAD, and are still read.
+var (
+	encryptedMagic = []byte("\x00enc2")
+	legacyMagic    = []byte("\x00enc1")
+)
+
+// scrypt parameters for deriving the key that wraps the data key.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	dataKeyBytes = 32
+)
+
+// wrappedKey is the stored form of an account's data key.
+type wrappedKey struct {
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Key  []byte `json:"key"` // nonce followed by the sealed data key
+}
+
+// dataKeyKey generates the database key for a user's wrapped data key.
+func dataKeyKey(username string) []byte {
+	return []byte("userkey:" + username)
+}
+
+// EnableEncryption makes accounts encrypt their tasks: new accounts from
+// creation, and existing ones the next time they sign in. Accounts that are
+// already encrypted stay encrypted either way.
+func (s *Store) EnableEncryption() {
+	s.encrypt = true
+}
+
+// Lock forgets the unlocked data key of username, e.g. on log out. When
+// the user signed in more than once, e.g. from two terminals connected to a
+// server, the key is kept until every sign-in has locked it.
+func (s *Store) Lock(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds[username] > 1 {
+		s.holds[username]--
+		return
+	}
+	delete(s.holds, username)
+	delete(s.keys, username)
+}
+
+// hold counts a sign-in of username, to be undone by Lock.
+func (s *Store) hold(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds == nil {
+		s.holds = map[string]int{}
+	}
+	s.holds[username]++
+}
+
+// forget forgets the unlocked data key of username whoever signed in, e.g.
+// when the account is deleted.
+func (s *Store) forget(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.holds, username)
+	delete(s.keys, username)
+}
+
+func (s *Store) dataKey(username string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[username]
+}
+
+func (s *Store) setDataKey(username string, key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = map[string][]byte{}
+	}
+	s.keys[username] = key
+}
+
+// unlock unwraps the data key of username with password and keeps it in
+// memory. If the account has no data key and encryption is enabled, one is
+// created and the account's existing data is encrypted with it. A read-only
+// store only unwraps the data key. The key is only kept once the
+// transaction has committed, so that a sign-in that fails, e.g. on a
+// conflict with another first sign-in, cannot replace the stored one.
+func (s *Store) unlock(username, password string) error {
+	var key []byte
+	var err error
+	if s.readOnly {
+		err = s.db.View(func(txn *badger.Txn) error {
+			wk, err := readWrappedKey(txn, username)
+			if err != nil || wk == nil {
+				return err
+			}
+			key, err = wk.unwrap(password)
+			return err
+		})
+	} else {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			wk, err := readWrappedKey(txn, username)
+			if err != nil {
+				return err
+			}
+			if wk != nil {
+				if key, err = wk.unwrap(password); err != nil {
+					return err
+				}
+				// Accounts encrypted before boards could be shared have no key pair
+				if err := ensureBoxKeys(txn, username, key); err != nil {
+					return err
+				}
+			} else {
+				if !s.encrypt {
+					return nil
+				}
+				if key, err = createDataKey(txn, username, password); err != nil {
+					return err
+				}
+				if err := encryptExisting(txn, username, key); err != nil {
+					return err
+				}
+			}
+			return sealShares(txn, username, key)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		s.setDataKey(username, key)
+	}
+	return nil
+}
+
+// createDataKey generates and stores a data key for username, wrapped with
+// password. The caller keeps it unlocked once txn has committed.
+func createDataKey(txn *badger.Txn, username, password string) ([]byte, error) {
+	key := make([]byte, dataKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := writeWrappedKey(txn, username, key, password); err != nil {
+		return nil, err
+	}
+	if err := ensureBoxKeys(txn, username, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// rekey re-wraps the unlocked data key of username with a new password. It
+// is a no-op for accounts that are not encrypted.
+func (s *Store) rekey(txn *badger.Txn, username, newPassword string) error {
+	wk, err := readWrappedKey(txn, username)
+	if err != nil || wk == nil {
+		return err
+	}
+	key := s.dataKey(username)
+	if key == nil {
+		return ErrLocked
+	}
+	return writeWrappedKey(txn, username, key, newPassword)
+}
+
+func readWrappedKey(txn *badger.Txn, username string) (*wrappedKey, error) {
+	item, err := txn.Get(dataKeyKey(username))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving data key: %w", err)
+	}
+	var wk wrappedKey
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &wk)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return &wk, nil
+}
+
+func writeWrappedKey(txn *badger.Txn, username string, key []byte, password string) error {
+	wk := wrappedKey{Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(wk.Salt); err != nil {
+		return err
+	}
+	kek, err := wk.derive(password)
+	if err != nil {
+		return err
+	}
+	if wk.Key, err = seal(kek, key, nil); err != nil {
+		return err
+	}
+	val, err := json.Marshal(wk)
+	if err != nil {
+		return err
+	}
+	return txn.Set(dataKeyKey(username), val)
+}
+
+func (wk wrappedKey) derive(password string) ([]byte, error) {
+	return scrypt.Key([]byte(password), wk.Salt, wk.N, wk.R, wk.P, dataKeyBytes)
+}
+
+func (wk wrappedKey) unwrap(password string) ([]byte, error) {
+	kek, err := wk.derive(password)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(kek, wk.Key, nil)
+	if err != nil {
+		return nil, errors.New("failed to unlock data key")
+	}
+	return key, nil
+}
+
+// encryptExisting encrypts the plaintext values of username with key. The
+// plaintext versions of the values are discarded, so that they are not
+// kept in backups nor compacted back.
+func encryptExisting(txn *badger.Txn, username string, key []byte) error {
+	for _, k := range dataKeys(txn, username) {
+		item, err := txn.Get(k)
+		if err != nil {
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if isEncrypted(val) {
+			continue
+		}
+		sealed, err := encryptValue(key, valueAAD(k, username), val)
+		if err != nil {
+			return err
+		}
+		if err := txn.SetEntry(badger.NewEntry(k, sealed).WithDiscard()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataKeys returns the keys of the data of username, all of which is
+// encrypted for an encrypted account.
+func dataKeys(txn *badger.Txn, username string) [][]byte {
+	return append(userKeys(txn, "tasks", username, 1), userKeys(txn, "sync", username, 1)...)
+}
+
+// userKeys returns the keys "kind:username:rest" of username, where rest is
+// made of parts parts separated by ':'. The names of legacy users may
+// contain ':', so the keys of "bob:x" also start with "kind:bob:"; they
+// have more parts.
+func userKeys(txn *badger.Txn, kind, username string, parts int) [][]byte {
+	var keys [][]byte
+	prefix := []byte(kind + ":" + username + ":")
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		if ownKey(it.Item().Key(), prefix, parts) {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+	}
+	return keys
+}
+
+// ownKey reports whether key, which starts with prefix, is followed by
+// parts parts separated by ':'.
+func ownKey(key, prefix []byte, parts int) bool {
+	return bytes.Count(key[len(prefix):], []byte(":")) == parts-1
+}
+
+// valueAAD returns the data authenticated with a value of owner stored
+// under key: the key without the username, e.g. "tasks:0" for
+// "tasks:alice:0". A value cannot be passed off as that of another of the
+// keys of owner, and stays valid when owner is renamed; the values of other
+// users are sealed with other keys.
+func valueAAD(key []byte, owner string) []byte {
+	kind, rest, _ := bytes.Cut(key, []byte(":"))
+	rest = bytes.TrimPrefix(rest, []byte(owner+":"))
+	return append(append(append([]byte{}, kind...), ':'), rest...)
+}
+
+// sealValue encrypts val, written by username to the board of owner under
+// dbKey, for storage if the board is encrypted. It must run inside txn so
+// the check and the write agree.
+func (s *Store) sealValue(txn *badger.Txn, username, owner string, dbKey, val []byte) ([]byte, error) {
+	key, err := s.boardKey(txn, username, owner)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		wk, err := readWrappedKey(txn, owner)
+		if err != nil {
+			return nil, err
+		}
+		if wk != nil {
+			return nil, ErrLocked
+		}
+		return val, nil
+	}
+	return encryptValue(key, valueAAD(dbKey, owner), val)
+}
+
+// openValue decrypts a value of the board of owner stored under dbKey for
+// username; plaintext values are returned as they are.
+func (s *Store) openValue(txn *badger.Txn, username, owner string, dbKey, val []byte) ([]byte, error) {
+	if !isEncrypted(val) {
+		return val, nil
+	}
+	key, err := s.boardKey(txn, username, owner)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrLocked
+	}
+	var plain []byte
+	if bytes.HasPrefix(val, legacyMagic) {
+		plain, err = open(key, val[len(legacyMagic):], nil)
+	} else {
+		plain, err = open(key, val[len(encryptedMagic):], valueAAD(dbKey, owner))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plain, nil
+}
+
+// isEncrypted reports whether a stored value is encrypted.
+func isEncrypted(val []byte) bool {
+	return bytes.HasPrefix(val, encryptedMagic) || bytes.HasPrefix(val, legacyMagic)
+}
+
+// encryptValue returns the stored form of val encrypted with key, with aad
+// authenticated along, see valueAAD.
+func encryptValue(key, aad, val []byte) ([]byte, error) {
+	sealed, err := seal(key, val, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, encryptedMagic...), sealed...), nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
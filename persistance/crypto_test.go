@@ -0,0 +1,246 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// storedValue returns the value stored under key as it is in the database.
+func storedValue(t *testing.T, s *Store, key []byte) []byte {
+	t.Helper()
+	var val []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+// checkTasks checks that the Todo column of username holds one task titled
+// title.
+func checkTasks(t *testing.T, s *Store, username, title string) {
+	t.Helper()
+	tasks, err := s.LoadTasks(username, Todo)
+	if err != nil {
+		t.Fatalf("LoadTasks: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != title {
+		t.Fatalf("LoadTasks = %+v, want one task %q", tasks, title)
+	}
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	if err := s.SaveTasks("alice", Todo, []Task{{Title: "secret plan"}}); err != nil {
+		t.Fatal(err)
+	}
+	val := storedValue(t, s, taskKey("alice", Todo))
+	if !isEncrypted(val) || bytes.Contains(val, []byte("secret plan")) {
+		t.Fatalf("tasks stored in the clear: %q", val)
+	}
+
+	s.Lock("alice")
+	if _, err := s.LoadTasks("alice", Todo); !errors.Is(err, ErrLocked) {
+		t.Fatalf("LoadTasks when locked = %v, want ErrLocked", err)
+	}
+	if err := s.SaveTasks("alice", Todo, nil); !errors.Is(err, ErrLocked) {
+		t.Fatalf("SaveTasks when locked = %v, want ErrLocked", err)
+	}
+
+	if _, err := s.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	checkTasks(t, s, "alice", "secret plan")
+}
+
+func TestEncryptionRekey(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	if err := s.SaveTasks("alice", Todo, []Task{{Title: "secret plan"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ChangePassword("alice", "password", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	s.forget("alice")
+
+	if _, err := s.AuthenticateUser("alice", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	checkTasks(t, s, "alice", "secret plan")
+	s.forget("alice")
+	if err := s.unlock("alice", "password"); err == nil {
+		t.Fatal("the data key was unlocked with the old password")
+	}
+}
+
+func TestEncryptExistingOnSignIn(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	if err := s.SaveTasks("alice", Todo, []Task{{Title: "old plan"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Lock("alice")
+	if isEncrypted(storedValue(t, s, taskKey("alice", Todo))) {
+		t.Fatal("tasks encrypted before encryption was enabled")
+	}
+
+	s.EnableEncryption()
+	if _, err := s.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if !isEncrypted(storedValue(t, s, taskKey("alice", Todo))) {
+		t.Fatal("tasks not encrypted on sign in")
+	}
+	s.Lock("alice")
+	if _, err := s.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	checkTasks(t, s, "alice", "old plan")
+
+	// The plaintext versions are not kept
+	var backup bytes.Buffer
+	if _, err := s.Backup(&backup, false); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(backup.Bytes(), []byte("old plan")) {
+		t.Fatal("the backup holds the tasks in the clear")
+	}
+}
+
+func TestEncryptedValueBoundToKey(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	if err := s.SaveTasks("alice", Todo, []Task{{Title: "todo"}}); err != nil {
+		t.Fatal(err)
+	}
+	val := storedValue(t, s, taskKey("alice", Todo))
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(taskKey("alice", Done), val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LoadTasks("alice", Done); err == nil {
+		t.Fatal("a value moved to another key was decrypted")
+	}
+}
+
+func TestEncryptedRename(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	if err := s.SaveTasks("alice", Todo, []Task{{Title: "secret plan"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RenameUser("alice", "alison"); err != nil {
+		t.Fatal(err)
+	}
+	checkTasks(t, s, "alison", "secret plan")
+}
+
+// The key kept in memory after first sign-ins at once must be the one
+// stored, whichever of them committed.
+func TestUnlockConcurrentFirstSignIns(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	s.Lock("alice")
+	s.EnableEncryption()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.unlock("alice", "password")
+		}()
+	}
+	wg.Wait()
+
+	var stored []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		wk, err := readWrappedKey(txn, "alice")
+		if err != nil {
+			return err
+		}
+		if wk == nil {
+			return errors.New("no data key stored")
+		}
+		stored, err = wk.unwrap("password")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.dataKey("alice"), stored) {
+		t.Fatal("the data key in memory is not the one stored")
+	}
+}
+
+func TestLegacyNameWithColon(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "bob")
+	// Keys of a legacy user "bob:x", whose name was never made canonical
+	legacy := map[string]string{
+		"tasks:bob:x:0":             `[{"title":"legacy plan"}]`,
+		"sync:bob:x:todotxt":        `{}`,
+		"sshkey:bob:x:SHA256:abcde": `{"fingerprint":"SHA256:abcde"}`,
+	}
+	err := s.db.Update(func(txn *badger.Txn) error {
+		for k, v := range legacy {
+			if err := txn.Set([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Lock("bob")
+
+	s.EnableEncryption()
+	if _, err := s.AuthenticateUser("bob", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := s.AuthorizedKeys("bob"); err != nil || len(keys) != 0 {
+		t.Errorf("AuthorizedKeys(bob) = %v, %v, want none", keys, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte("tasks:bob:x:0"), []byte(legacy["tasks:bob:x:0"]))
+		})
+	}()
+	if err := s.WaitBoard(ctx, "bob"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitBoard(bob) = %v when the tasks of bob:x were saved", err)
+	}
+
+	if err := s.DeleteUser("bob", "password"); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range legacy {
+		if got := storedValue(t, s, []byte(k)); string(got) != v {
+			t.Errorf("%s = %q after bob was encrypted and deleted, want %q", k, got, v)
+		}
+	}
+}
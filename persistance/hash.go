@@ -0,0 +1,134 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms, see SetHashing.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// argon2id parameters: the second recommended option of RFC 9106.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+const argon2Prefix = "$argon2id$"
+
+// SetHashing selects how new password hashes are made. Existing hashes
+// made differently, or with another bcrypt cost, are replaced the next time
+// their user signs in.
+func (s *Store) SetHashing(algorithm string, bcryptCost int) {
+	s.hashAlgorithm = algorithm
+	s.bcryptCost = bcryptCost
+}
+
+func (s *Store) hashPassword(password string) ([]byte, error) {
+	if s.hashAlgorithm == HashArgon2id {
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return []byte(fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+			argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+	}
+	cost := s.bcryptCost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
+// needsRehash reports whether hash was made differently from what
+// SetHashing asks for.
+func (s *Store) needsRehash(hash []byte) bool {
+	if strings.HasPrefix(string(hash), argon2Prefix) {
+		p, _, _, err := parseArgon2(hash)
+		return s.hashAlgorithm != HashArgon2id || err != nil ||
+			p.time != argon2Time || p.memory != argon2Memory || p.threads != argon2Threads
+	}
+	if s.hashAlgorithm == HashArgon2id {
+		return true
+	}
+	cost, err := bcrypt.Cost(hash)
+	want := s.bcryptCost
+	if want == 0 {
+		want = bcrypt.DefaultCost
+	}
+	return err != nil || cost != want
+}
+
+// rehash replaces the password hash of username with one made as SetHashing
+// asks for.
+func (s *Store) rehash(username, password string) error {
+	if s.readOnly {
+		return nil
+	}
+	hashedPassword, err := s.hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("could not hash password: %w", err)
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(userKey(username), hashedPassword)
+	})
+}
+
+// comparePassword reports whether password matches hash, made by bcrypt or
+// argon2id.
+func comparePassword(hash, password []byte) bool {
+	if !strings.HasPrefix(string(hash), argon2Prefix) {
+		return bcrypt.CompareHashAndPassword(hash, password) == nil
+	}
+	p, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey(password, salt, p.time, p.memory, p.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1
+}
+
+type argon2Params struct {
+	time, memory uint32
+	threads      uint8
+}
+
+// parseArgon2 splits a hash such as "$argon2id$v=19$m=65536,t=3,p=4$salt$key".
+func parseArgon2(hash []byte) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	return p, salt, key, nil
+}
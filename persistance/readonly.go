@@ -0,0 +1,179 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// A read-only store changes nothing in the database: operations that would
+// return ErrReadOnly. Signing in still works, but failed attempts are not
+// counted, hashes are not upgraded and recovery codes cannot be used, as
+// they could not be used up.
+
+// ErrReadOnly is returned by operations that would change a read-only
+// store.
+var ErrReadOnly = errors.New("the database is open read-only")
+
+// snapshotAttempts is how many times NewReadOnlyStore copies a database
+// that changed while it was copied.
+const snapshotAttempts = 3
+
+// NewReadOnlyStore opens the database in baseDir read-only. BadgerDB cannot
+// do so while another process has the database open, so the store then
+// opens a copy of it, made when it is called; see Snapshot.
+func NewReadOnlyStore(baseDir string) (*Store, error) {
+	dbDir := DBDir(baseDir)
+	if _, err := os.Stat(dbDir); err != nil {
+		return nil, fmt.Errorf("no database to open read-only: %w", err)
+	}
+	log.Printf("BadgerDB directory: %s (read-only)\n", dbDir)
+
+	db, err := openDB(dbDir, true)
+	if err == nil {
+		return newReadOnlyStore(db)
+	}
+	if !errors.Is(err, ErrInUse) {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		s, serr := openSnapshot(dbDir)
+		if serr == nil {
+			return s, nil
+		}
+		if attempt == snapshotAttempts {
+			return nil, fmt.Errorf("%w, and copying it failed: %v", err, serr)
+		}
+	}
+}
+
+func newReadOnlyStore(db *badger.DB) (*Store, error) {
+	s := &Store{db: db, readOnly: true}
+	if err := s.checkSchema(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSnapshot copies the database in dbDir, in use by another process,
+// to a temporary directory and opens a read-only store on the copy, which is
+// removed when the store is closed.
+func openSnapshot(dbDir string) (*Store, error) {
+	dir, err := os.MkdirTemp("", "todo-elm-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	taken := time.Now()
+	if err := copyDB(dbDir, dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// Opened for writing, unlike the database itself: the copy usually
+	// needs its logs truncated, as the database was not closed
+	db, err := openDB(dir, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s, err := newReadOnlyStore(db)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.snapshot, s.taken = dir, taken
+	return s, nil
+}
+
+// copyDB copies the files of the database in src, while it is in use, to
+// dst. The logs are copied before the manifest, and the tables after it, so
+// that whatever is moved from a log to a table meanwhile is in the copy; a
+// table removed meanwhile makes the copy fail to open.
+func copyDB(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	order := func(name string) int {
+		switch {
+		case strings.HasSuffix(name, ".mem"), strings.HasSuffix(name, ".vlog"):
+			return 0
+		case strings.HasPrefix(name, "MANIFEST"):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return order(entries[i].Name()) < order(entries[j].Name())
+	})
+	for _, e := range entries {
+		if !e.Type().IsRegular() || e.Name() == "LOCK" {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed since it was listed
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to dst, keeping it sparse where the system can tell
+// the holes apart, see copyData: BadgerDB allocates its logs at their
+// largest size, gigabytes mostly never written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := copyData(in, out, fi.Size()); err != nil {
+		return err
+	}
+	if err := out.Truncate(fi.Size()); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// ReadOnly reports whether the store was opened with NewReadOnlyStore.
+func (s *Store) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Snapshot reports whether a read-only store opened a copy of the database,
+// as another process had it open, and when the copy was made. Changes made
+// since are not seen.
+func (s *Store) Snapshot() (time.Time, bool) {
+	return s.taken, s.snapshot != ""
+}
+
+// update runs fn in a read-write transaction, unless the store is
+// read-only.
+func (s *Store) update(fn func(txn *badger.Txn) error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return s.db.Update(fn)
+}
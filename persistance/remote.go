@@ -0,0 +1,422 @@
+package persistence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RemoteStore is the store of a daemon, used over a connection to its
+// RPCServer. Its methods are those of Store, run by the daemon.
+type RemoteStore struct {
+	conn   net.Conn
+	status rpcStatus
+
+	mu      sync.Mutex
+	enc     *json.Encoder
+	nextID  uint64
+	pending map[uint64]chan rpcResponse
+	err     error // why the connection ended, once it did
+}
+
+// DialStore connects to the daemon listening on the Unix socket at path.
+func DialStore(path string) (*RemoteStore, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	r := &RemoteStore{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: map[uint64]chan rpcResponse{},
+	}
+	go r.read()
+	if err := r.call(context.Background(), "Status", rpcParams{}, &r.status); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// read delivers the responses of the daemon until the connection ends.
+func (r *RemoteStore) read() {
+	dec := json.NewDecoder(r.conn)
+	var err error
+	for {
+		var resp rpcResponse
+		if err = dec.Decode(&resp); err != nil {
+			break
+		}
+		id, perr := strconv.ParseUint(string(resp.ID), 10, 64)
+		r.mu.Lock()
+		ch, ok := r.pending[id]
+		delete(r.pending, id)
+		r.mu.Unlock()
+		if perr == nil && ok {
+			ch <- resp
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = fmt.Errorf("%w: connection to the daemon ended: %v", ErrStoreClosed, err)
+	for id, ch := range r.pending {
+		close(ch)
+		delete(r.pending, id)
+	}
+}
+
+// call runs method on the daemon and decodes its result into result, unless
+// nil.
+func (r *RemoteStore) call(ctx context.Context, method string, p rpcParams, result any) error {
+	params, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ch := make(chan rpcResponse, 1)
+	r.mu.Lock()
+	if r.err != nil {
+		r.mu.Unlock()
+		return r.err
+	}
+	r.nextID++
+	id := r.nextID
+	r.pending[id] = ch
+	err = r.enc.Encode(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(strconv.FormatUint(id, 10)),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		delete(r.pending, id)
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrStoreClosed, err)
+	}
+	r.mu.Unlock()
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return r.err
+		}
+		if resp.Error != nil {
+			return resp.Error.err()
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-ctx.Done():
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// do is call without a context.
+func (r *RemoteStore) do(method string, p rpcParams, result any) error {
+	return r.call(context.Background(), method, p, result)
+}
+
+// Admin makes the connection that of an administrator, with the token of
+// the daemon, so that it can use the methods not done on behalf of a user
+// signed in through it: Users, SetDisabled, AuthenticateKey and the like.
+func (r *RemoteStore) Admin(token string) error {
+	return r.do("Admin", rpcParams{Token: token}, nil)
+}
+
+// Close closes the connection; the daemon locks the users signed in
+// through it.
+func (r *RemoteStore) Close() error {
+	return r.conn.Close()
+}
+
+// ReadOnly reports whether the daemon opened its store read-only.
+func (r *RemoteStore) ReadOnly() bool {
+	return r.status.ReadOnly
+}
+
+// Snapshot reports whether the store of the daemon is a copy of the
+// database, see Store.Snapshot.
+func (r *RemoteStore) Snapshot() (time.Time, bool) {
+	return r.status.Taken, r.status.Snapshot
+}
+
+func (r *RemoteStore) CreateUser(username, password string) (string, error) {
+	var name string
+	err := r.do("CreateUser", rpcParams{Username: username, Password: password}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) AuthenticateUser(username, password string) (string, error) {
+	var name string
+	err := r.do("AuthenticateUser", rpcParams{Username: username, Password: password}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) AuthenticateUserWithCode(username, password, code string) (string, error) {
+	var name string
+	err := r.do("AuthenticateUserWithCode", rpcParams{Username: username, Password: password, Code: code}, &name)
+	return name, err
+}
+
+// Lock locks username on the daemon, if this connection signed them in.
+// Errors are ignored, as the daemon locks them when the connection ends.
+func (r *RemoteStore) Lock(username string) {
+	r.do("Lock", rpcParams{Username: username}, nil)
+}
+
+func (r *RemoteStore) ChangePassword(username, oldPassword, newPassword string) error {
+	return r.do("ChangePassword", rpcParams{Username: username, Password: oldPassword, NewPassword: newPassword}, nil)
+}
+
+func (r *RemoteStore) DeleteUser(username, password string) error {
+	return r.do("DeleteUser", rpcParams{Username: username, Password: password}, nil)
+}
+
+func (r *RemoteStore) CreateSession(username string, ttl time.Duration) (string, error) {
+	var token string
+	err := r.do("CreateSession", rpcParams{Username: username, TTL: ttl}, &token)
+	return token, err
+}
+
+func (r *RemoteStore) ResumeSession(token string) (string, error) {
+	var name string
+	err := r.do("ResumeSession", rpcParams{Token: token}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) EndSession(token string) error {
+	return r.do("EndSession", rpcParams{Token: token}, nil)
+}
+
+func (r *RemoteStore) Sessions(username string) ([]Session, error) {
+	var listed []rpcSession
+	if err := r.do("Sessions", rpcParams{Username: username}, &listed); err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, len(listed))
+	for i, sess := range listed {
+		sessions[i] = sess.Session
+		sessions[i].ID = sess.ID
+	}
+	return sessions, nil
+}
+
+func (r *RemoteStore) RevokeSession(username, id string) (int, error) {
+	var n int
+	err := r.do("RevokeSession", rpcParams{Username: username, ID: id}, &n)
+	return n, err
+}
+
+func (r *RemoteStore) TOTPEnabled(username string) (bool, error) {
+	var enabled bool
+	err := r.do("TOTPEnabled", rpcParams{Username: username}, &enabled)
+	return enabled, err
+}
+
+func (r *RemoteStore) BeginTOTP(username string) (TOTPEnrollment, error) {
+	var e TOTPEnrollment
+	err := r.do("BeginTOTP", rpcParams{Username: username}, &e)
+	return e, err
+}
+
+func (r *RemoteStore) ConfirmTOTP(username, code string) ([]string, error) {
+	var codes []string
+	err := r.do("ConfirmTOTP", rpcParams{Username: username, Code: code}, &codes)
+	return codes, err
+}
+
+func (r *RemoteStore) DisableTOTP(username, password, code string) error {
+	return r.do("DisableTOTP", rpcParams{Username: username, Password: password, Code: code}, nil)
+}
+
+func (r *RemoteStore) RecoveryCodesLeft(username string) (int, error) {
+	var n int
+	err := r.do("RecoveryCodesLeft", rpcParams{Username: username}, &n)
+	return n, err
+}
+
+func (r *RemoteStore) AddAuthorizedKey(username, line string) (AuthorizedKey, error) {
+	var k AuthorizedKey
+	err := r.do("AddAuthorizedKey", rpcParams{Username: username, Line: line}, &k)
+	return k, err
+}
+
+func (r *RemoteStore) AuthorizedKeys(username string) ([]AuthorizedKey, error) {
+	var keys []AuthorizedKey
+	err := r.do("AuthorizedKeys", rpcParams{Username: username}, &keys)
+	return keys, err
+}
+
+func (r *RemoteStore) RemoveAuthorizedKey(username, fingerprint string) error {
+	return r.do("RemoveAuthorizedKey", rpcParams{Username: username, Fingerprint: fingerprint}, nil)
+}
+
+func (r *RemoteStore) KeyAuthorized(username string, pub ssh.PublicKey) (string, error) {
+	var name string
+	err := r.do("KeyAuthorized", rpcParams{Username: username, Key: pub.Marshal()}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) AuthenticateKey(username string, pub ssh.PublicKey) (string, error) {
+	var name string
+	err := r.do("AuthenticateKey", rpcParams{Username: username, Key: pub.Marshal()}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) SaveTasks(username string, status TaskStatus, tasks []Task) error {
+	return r.do("SaveTasks", rpcParams{Username: username, Status: status, Tasks: tasks}, nil)
+}
+
+func (r *RemoteStore) LoadTasks(username string, status TaskStatus) ([]Task, error) {
+	var tasks []Task
+	err := r.do("LoadTasks", rpcParams{Username: username, Status: status}, &tasks)
+	return tasks, err
+}
+
+func (r *RemoteStore) SaveBoardTasks(username, owner string, status TaskStatus, tasks []Task) error {
+	return r.do("SaveBoardTasks", rpcParams{Username: username, Owner: owner, Status: status, Tasks: tasks}, nil)
+}
+
+func (r *RemoteStore) LoadBoardTasks(username, owner string, status TaskStatus) ([]Task, error) {
+	var tasks []Task
+	err := r.do("LoadBoardTasks", rpcParams{Username: username, Owner: owner, Status: status}, &tasks)
+	return tasks, err
+}
+
+func (r *RemoteStore) LoadBoard(username, owner string) (BoardTasks, error) {
+	var b BoardTasks
+	err := r.do("LoadBoard", rpcParams{Username: username, Owner: owner}, &b)
+	return b, err
+}
+
+func (r *RemoteStore) SaveBoard(username, owner string, b BoardTasks) (uint64, error) {
+	var rev uint64
+	err := r.do("SaveBoard", rpcParams{Username: username, Owner: owner, Board: &b}, &rev)
+	return rev, err
+}
+
+// WaitBoard waits on the daemon, see Store.WaitBoard. The daemon stops
+// waiting at the deadline of ctx, if any.
+func (r *RemoteStore) WaitBoard(ctx context.Context, owner string) error {
+	p := rpcParams{Owner: owner}
+	if deadline, ok := ctx.Deadline(); ok {
+		p.Timeout = time.Until(deadline)
+	}
+	return r.call(ctx, "WaitBoard", p, nil)
+}
+
+func (r *RemoteStore) SaveSyncState(username, name string, state []byte) error {
+	return r.do("SaveSyncState", rpcParams{Username: username, Name: name, State: state}, nil)
+}
+
+func (r *RemoteStore) LoadSyncState(username, name string) ([]byte, error) {
+	var state []byte
+	err := r.do("LoadSyncState", rpcParams{Username: username, Name: name}, &state)
+	return state, err
+}
+
+func (r *RemoteStore) ShareBoard(owner, member string, role Role) error {
+	return r.do("ShareBoard", rpcParams{Owner: owner, Member: member, Role: role}, nil)
+}
+
+func (r *RemoteStore) UnshareBoard(owner, member string) error {
+	return r.do("UnshareBoard", rpcParams{Owner: owner, Member: member}, nil)
+}
+
+func (r *RemoteStore) Shares(owner string) ([]Share, error) {
+	var shares []Share
+	err := r.do("Shares", rpcParams{Owner: owner}, &shares)
+	return shares, err
+}
+
+func (r *RemoteStore) Boards(username string) ([]BoardRef, error) {
+	var boards []BoardRef
+	err := r.do("Boards", rpcParams{Username: username}, &boards)
+	return boards, err
+}
+
+func (r *RemoteStore) BoardMembers(owner string) ([]string, error) {
+	var members []string
+	err := r.do("BoardMembers", rpcParams{Owner: owner}, &members)
+	return members, err
+}
+
+func (r *RemoteStore) BoardRole(username, owner string) (Role, error) {
+	var role Role
+	err := r.do("BoardRole", rpcParams{Username: username, Owner: owner}, &role)
+	return role, err
+}
+
+func (r *RemoteStore) AssignedTasks(username string) ([]AssignedTask, error) {
+	var tasks []AssignedTask
+	err := r.do("AssignedTasks", rpcParams{Username: username}, &tasks)
+	return tasks, err
+}
+
+func (r *RemoteStore) Users() ([]UserInfo, error) {
+	var users []UserInfo
+	err := r.do("Users", rpcParams{}, &users)
+	return users, err
+}
+
+func (r *RemoteStore) User(username string) (UserInfo, error) {
+	var u UserInfo
+	err := r.do("User", rpcParams{Username: username}, &u)
+	return u, err
+}
+
+func (r *RemoteStore) SetDisabled(username string, disabled bool) error {
+	return r.do("SetDisabled", rpcParams{Username: username, Disabled: disabled}, nil)
+}
+
+func (r *RemoteStore) ResetPassword(username, password string) (bool, error) {
+	var ok bool
+	err := r.do("ResetPassword", rpcParams{Username: username, Password: password}, &ok)
+	return ok, err
+}
+
+func (r *RemoteStore) RenameUser(oldName, newName string) (string, error) {
+	var name string
+	err := r.do("RenameUser", rpcParams{Username: oldName, NewName: newName}, &name)
+	return name, err
+}
+
+func (r *RemoteStore) TaskCounts(username string) (map[TaskStatus]int, error) {
+	var counts map[TaskStatus]int
+	err := r.do("TaskCounts", rpcParams{Username: username}, &counts)
+	return counts, err
+}
+
+// Backup writes a backup made by the daemon to w, see Store.Backup. The
+// daemon writes it to a temporary file on its way. Only administrators can
+// make a backup, see Admin.
+func (r *RemoteStore) Backup(w io.Writer, compress bool) (BackupManifest, error) {
+	f, err := os.CreateTemp("", "todo-elm-backup-")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	var m BackupManifest
+	if err := r.do("Backup", rpcParams{Path: f.Name(), Compress: compress}, &m); err != nil {
+		return BackupManifest{}, err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return BackupManifest{}, err
+	}
+	return m, nil
+}
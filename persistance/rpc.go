@@ -0,0 +1,621 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A daemon gives other processes access to its store with JSON-RPC 2.0:
+// requests and responses are JSON objects, one after the other on a
+// connection. Methods are named after those of Backend, and their params
+// are an object with the fields of rpcParams they need, e.g.
+//
+//	{"jsonrpc": "2.0", "id": 1, "method": "LoadBoard", "params": {"username": "alice", "owner": "alice"}}
+//
+// Errors of the store carry their kind in data, so that clients get them
+// back as the same errors. Requests are served concurrently, so a client
+// can wait for a board while making other calls. The users a connection
+// signs in are locked when it ends, as if it called Lock for them.
+//
+// A connection acts on behalf of the users it signed in, and only them:
+// see rpcMethods for what each method needs. The methods of administrators
+// are only allowed once the connection called Admin with the token of the
+// daemon, which whoever can read the database can read too.
+
+// rpcParams holds the arguments of every method.
+type rpcParams struct {
+	Username    string        `json:"username,omitempty"`
+	Owner       string        `json:"owner,omitempty"`
+	Member      string        `json:"member,omitempty"`
+	Password    string        `json:"password,omitempty"`
+	NewPassword string        `json:"new_password,omitempty"`
+	NewName     string        `json:"new_name,omitempty"`
+	Code        string        `json:"code,omitempty"`
+	Token       string        `json:"token,omitempty"`
+	ID          string        `json:"id,omitempty"` // of a session
+	Role        Role          `json:"role,omitempty"`
+	Line        string        `json:"line,omitempty"` // of an authorized key
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	Key         []byte        `json:"key,omitempty"` // SSH public key, in wire format
+	Status      TaskStatus    `json:"status"`
+	Tasks       []Task        `json:"tasks,omitempty"`
+	Board       *BoardTasks   `json:"board,omitempty"`
+	Name        string        `json:"name,omitempty"` // of a sync state
+	State       []byte        `json:"state,omitempty"`
+	Disabled    bool          `json:"disabled,omitempty"`
+	Compress    bool          `json:"compress,omitempty"`
+	TTL         time.Duration `json:"ttl,omitempty"`     // nanoseconds
+	Timeout     time.Duration `json:"timeout,omitempty"` // nanoseconds, 0 for none
+	Path        string        `json:"path,omitempty"`    // of the file to write a backup to
+}
+
+// rpcAccess is who may call a method.
+type rpcAccess int
+
+const (
+	accessAnyone rpcAccess = iota // signs in, or checks a password or token itself
+	accessUser                    // the connection signed in username
+	accessOwner                   // the connection signed in owner
+	accessBoard                   // the connection signed in a user who can open the board of owner
+	accessAdmin                   // the connection called Admin
+)
+
+// rpcMethods lists the methods of an RPCServer and who may call them.
+var rpcMethods = map[string]rpcAccess{
+	"Status":                   accessAnyone,
+	"Admin":                    accessAnyone,
+	"CreateUser":               accessAnyone,
+	"AuthenticateUser":         accessAnyone,
+	"AuthenticateUserWithCode": accessAnyone,
+	"Lock":                     accessAnyone,
+	"ResumeSession":            accessAnyone,
+	"EndSession":               accessAnyone,
+	"DisableTOTP":              accessAnyone,
+
+	"ChangePassword":      accessUser,
+	"DeleteUser":          accessUser,
+	"CreateSession":       accessUser,
+	"Sessions":            accessUser,
+	"RevokeSession":       accessUser,
+	"TOTPEnabled":         accessUser,
+	"BeginTOTP":           accessUser,
+	"ConfirmTOTP":         accessUser,
+	"RecoveryCodesLeft":   accessUser,
+	"AddAuthorizedKey":    accessUser,
+	"AuthorizedKeys":      accessUser,
+	"RemoveAuthorizedKey": accessUser,
+	"SaveTasks":           accessUser,
+	"LoadTasks":           accessUser,
+	"SaveBoardTasks":      accessUser,
+	"LoadBoardTasks":      accessUser,
+	"LoadBoard":           accessUser,
+	"SaveBoard":           accessUser,
+	"SaveSyncState":       accessUser,
+	"LoadSyncState":       accessUser,
+	"Boards":              accessUser,
+	"BoardRole":           accessUser,
+	"AssignedTasks":       accessUser,
+
+	"ShareBoard":   accessOwner,
+	"UnshareBoard": accessOwner,
+	"Shares":       accessOwner,
+
+	"BoardMembers": accessBoard,
+	"WaitBoard":    accessBoard,
+
+	// Signing in with a key only proves anything to the SSH server, which
+	// checked the key
+	"KeyAuthorized":   accessAdmin,
+	"AuthenticateKey": accessAdmin,
+	"Users":           accessAdmin,
+	"User":            accessAdmin,
+	"SetDisabled":     accessAdmin,
+	"ResetPassword":   accessAdmin,
+	"RenameUser":      accessAdmin,
+	"TaskCounts":      accessAdmin,
+	"Backup":          accessAdmin,
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // none for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// Error codes of JSON-RPC 2.0, and the one of errors of the store.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcStoreError     = -32000
+)
+
+type rpcError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+// rpcErrorData describes an error of the store.
+type rpcErrorData struct {
+	Kind     string    `json:"kind,omitempty"` // see rpcErrorKinds
+	Owner    string    `json:"owner,omitempty"`
+	Revision uint64    `json:"revision,omitempty"`
+	Until    time.Time `json:"until,omitzero"`
+}
+
+// rpcErrorKinds names the errors clients can tell apart.
+var rpcErrorKinds = map[string]error{
+	"account_disabled":       ErrAccountDisabled,
+	"user_not_found":         ErrUserNotFound,
+	"conflict":               ErrConflict,
+	"locked":                 ErrLocked,
+	"read_only":              ErrReadOnly,
+	"session_invalid":        ErrSessionInvalid,
+	"permission_denied":      ErrPermissionDenied,
+	"unknown_key":            ErrUnknownKey,
+	"user_exists":            ErrUserExists,
+	"invalid_credentials":    ErrInvalidCredentials,
+	"second_factor_required": ErrSecondFactorRequired,
+	"invalid_code":           ErrInvalidCode,
+	"invalid_username":       ErrInvalidUsername,
+	"username_confusable":    ErrUsernameConfusable,
+	"store_closed":           ErrStoreClosed,
+	"deadline_exceeded":      context.DeadlineExceeded,
+	"canceled":               context.Canceled,
+}
+
+// toRPCError describes err for a client.
+func toRPCError(err error) *rpcError {
+	e := &rpcError{Code: rpcStoreError, Message: err.Error(), Data: &rpcErrorData{}}
+	var conflict *ConflictError
+	var locked *LockedError
+	switch {
+	case errors.As(err, &conflict):
+		e.Data.Kind, e.Data.Owner, e.Data.Revision = "conflict", conflict.Owner, conflict.Revision
+	case errors.As(err, &locked):
+		e.Data.Kind, e.Data.Until = "too_many_attempts", locked.Until
+	default:
+		for kind, target := range rpcErrorKinds {
+			if errors.Is(err, target) {
+				e.Data.Kind = kind
+				break
+			}
+		}
+	}
+	return e
+}
+
+// remoteError is an error of the store of a daemon, matching the error of
+// its kind with errors.Is.
+type remoteError struct {
+	msg string
+	err error // nil if of no known kind
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+func (e *remoteError) Unwrap() error { return e.err }
+
+// err returns the error e describes.
+func (e *rpcError) err() error {
+	if e.Code != rpcStoreError || e.Data == nil {
+		return fmt.Errorf("daemon: %s (%d)", e.Message, e.Code)
+	}
+	switch e.Data.Kind {
+	case "conflict":
+		return &ConflictError{Owner: e.Data.Owner, Revision: e.Data.Revision}
+	case "too_many_attempts":
+		return &LockedError{Until: e.Data.Until}
+	}
+	return &remoteError{msg: e.Message, err: rpcErrorKinds[e.Data.Kind]}
+}
+
+// rpcStatus is the result of the Status method.
+type rpcStatus struct {
+	ReadOnly bool      `json:"read_only"`
+	Snapshot bool      `json:"snapshot"`
+	Taken    time.Time `json:"taken,omitzero"`
+}
+
+// rpcSession is a Session as listed to clients, with its ID and without its
+// key.
+type rpcSession struct {
+	Session
+	ID string `json:"id"`
+}
+
+// RPCServer serves a store to the clients connecting to it, see RemoteStore.
+type RPCServer struct {
+	store      *Store
+	adminToken string
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// NewRPCServer returns a server giving access to store. Connections
+// calling Admin with adminToken may use the methods of administrators; none
+// can if it is empty.
+func NewRPCServer(store *Store, adminToken string) *RPCServer {
+	return &RPCServer{store: store, adminToken: adminToken, conns: map[net.Conn]bool{}}
+}
+
+// Serve serves the connections accepted by ln until Close.
+func (srv *RPCServer) Serve(ln net.Listener) error {
+	srv.mu.Lock()
+	srv.ln = ln
+	srv.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		srv.mu.Lock()
+		srv.conns[conn] = true
+		srv.mu.Unlock()
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			srv.serveConn(conn)
+			srv.mu.Lock()
+			delete(srv.conns, conn)
+			srv.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting connections and ends those in progress, locking
+// the users they signed in.
+func (srv *RPCServer) Close() error {
+	srv.mu.Lock()
+	var err error
+	if srv.ln != nil {
+		err = srv.ln.Close()
+	}
+	for conn := range srv.conns {
+		conn.Close()
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return err
+}
+
+// rpcConn is the state of a connection to an RPCServer.
+type rpcConn struct {
+	srv *RPCServer
+	ctx context.Context // done when the connection ends
+
+	mu    sync.Mutex
+	enc   *json.Encoder
+	holds map[string]int // sign-ins by username not locked yet
+	admin bool           // called Admin
+}
+
+func (srv *RPCServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &rpcConn{srv: srv, ctx: ctx, enc: json.NewEncoder(conn), holds: map[string]int{}}
+	var calls sync.WaitGroup
+	defer func() {
+		cancel()
+		calls.Wait()
+		for username, n := range c.holds {
+			for ; n > 0; n-- {
+				srv.store.Lock(username)
+			}
+		}
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var req rpcRequest
+		if err := dec.Decode(&req); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				c.respond(rpcResponse{Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			}
+			return
+		}
+		calls.Add(1)
+		go func() {
+			defer calls.Done()
+			resp := c.serve(req)
+			if req.ID != nil {
+				resp.ID = req.ID
+				c.respond(resp)
+			}
+		}()
+	}
+}
+
+func (c *rpcConn) respond(resp rpcResponse) {
+	resp.JSONRPC = "2.0"
+	if resp.ID == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enc.Encode(resp)
+}
+
+// serve runs the method of req.
+func (c *rpcConn) serve(req rpcRequest) rpcResponse {
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcResponse{Error: &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}}
+	}
+	var p rpcParams
+	if len(req.Params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(req.Params))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			return rpcResponse{Error: &rpcError{Code: rpcInvalidParams, Message: err.Error()}}
+		}
+	}
+	access, ok := rpcMethods[req.Method]
+	if !ok {
+		return rpcResponse{Error: &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("no method %q", req.Method)}}
+	}
+	if err := c.authorize(access, p); err != nil {
+		return rpcResponse{Error: toRPCError(err)}
+	}
+	result, err := c.call(req.Method, p)
+	if err != nil {
+		return rpcResponse{Error: toRPCError(err)}
+	}
+	val, err := json.Marshal(result)
+	if err != nil {
+		return rpcResponse{Error: toRPCError(err)}
+	}
+	return rpcResponse{Result: val}
+}
+
+// authorize checks that the connection may call a method needing access
+// with params p.
+func (c *rpcConn) authorize(access rpcAccess, p rpcParams) error {
+	c.mu.Lock()
+	admin := c.admin
+	var users []string
+	for username := range c.holds {
+		users = append(users, username)
+	}
+	c.mu.Unlock()
+
+	switch access {
+	case accessAnyone:
+		return nil
+	case accessUser:
+		if slices.Contains(users, p.Username) {
+			return nil
+		}
+	case accessOwner:
+		if slices.Contains(users, p.Owner) {
+			return nil
+		}
+	case accessBoard:
+		for _, username := range users {
+			if _, err := c.srv.store.BoardRole(username, p.Owner); err == nil {
+				return nil
+			}
+		}
+	case accessAdmin:
+		if admin {
+			return nil
+		}
+		return fmt.Errorf("%w: only administrators can do that, see Admin", ErrPermissionDenied)
+	}
+	return fmt.Errorf("%w: sign in first", ErrPermissionDenied)
+}
+
+// call runs a method of the store.
+func (c *rpcConn) call(method string, p rpcParams) (any, error) {
+	s := c.srv.store
+	switch method {
+	case "Status":
+		taken, snapshot := s.Snapshot()
+		return rpcStatus{ReadOnly: s.ReadOnly(), Snapshot: snapshot, Taken: taken}, nil
+	case "Admin":
+		token := c.srv.adminToken
+		if token == "" || subtle.ConstantTimeCompare([]byte(p.Token), []byte(token)) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		c.mu.Lock()
+		c.admin = true
+		c.mu.Unlock()
+		return nil, nil
+
+	case "CreateUser":
+		return c.held(s.CreateUser(p.Username, p.Password))
+	case "AuthenticateUser":
+		return c.held(s.AuthenticateUser(p.Username, p.Password))
+	case "AuthenticateUserWithCode":
+		return c.held(s.AuthenticateUserWithCode(p.Username, p.Password, p.Code))
+	case "Lock":
+		c.lock(p.Username)
+		return nil, nil
+	case "ChangePassword":
+		return nil, s.ChangePassword(p.Username, p.Password, p.NewPassword)
+	case "DeleteUser":
+		if err := s.DeleteUser(p.Username, p.Password); err != nil {
+			return nil, err
+		}
+		// Deleting the account ended every sign-in of it
+		c.mu.Lock()
+		delete(c.holds, p.Username)
+		c.mu.Unlock()
+		return nil, nil
+
+	case "CreateSession":
+		return s.CreateSession(p.Username, p.TTL)
+	case "ResumeSession":
+		return c.held(s.ResumeSession(p.Token))
+	case "EndSession":
+		return nil, s.EndSession(p.Token)
+	case "Sessions":
+		sessions, err := s.Sessions(p.Username)
+		listed := make([]rpcSession, len(sessions))
+		for i, sess := range sessions {
+			sess.Key = nil
+			listed[i] = rpcSession{Session: sess, ID: sess.ID}
+		}
+		return listed, err
+	case "RevokeSession":
+		return s.RevokeSession(p.Username, p.ID)
+
+	case "TOTPEnabled":
+		return s.TOTPEnabled(p.Username)
+	case "BeginTOTP":
+		return s.BeginTOTP(p.Username)
+	case "ConfirmTOTP":
+		return s.ConfirmTOTP(p.Username, p.Code)
+	case "DisableTOTP":
+		return nil, s.DisableTOTP(p.Username, p.Password, p.Code)
+	case "RecoveryCodesLeft":
+		return s.RecoveryCodesLeft(p.Username)
+
+	case "AddAuthorizedKey":
+		return s.AddAuthorizedKey(p.Username, p.Line)
+	case "AuthorizedKeys":
+		return s.AuthorizedKeys(p.Username)
+	case "RemoveAuthorizedKey":
+		return nil, s.RemoveAuthorizedKey(p.Username, p.Fingerprint)
+	case "KeyAuthorized", "AuthenticateKey":
+		pub, err := ssh.ParsePublicKey(p.Key)
+		if err != nil {
+			return nil, err
+		}
+		if method == "KeyAuthorized" {
+			return s.KeyAuthorized(p.Username, pub)
+		}
+		return c.held(s.AuthenticateKey(p.Username, pub))
+
+	case "SaveTasks":
+		return nil, s.SaveTasks(p.Username, p.Status, p.Tasks)
+	case "LoadTasks":
+		return s.LoadTasks(p.Username, p.Status)
+	case "SaveBoardTasks":
+		return nil, s.SaveBoardTasks(p.Username, p.Owner, p.Status, p.Tasks)
+	case "LoadBoardTasks":
+		return s.LoadBoardTasks(p.Username, p.Owner, p.Status)
+	case "LoadBoard":
+		return s.LoadBoard(p.Username, p.Owner)
+	case "SaveBoard":
+		if p.Board == nil {
+			return nil, errors.New("no board to save")
+		}
+		return s.SaveBoard(p.Username, p.Owner, *p.Board)
+	case "WaitBoard":
+		ctx := c.ctx
+		if p.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+			defer cancel()
+		}
+		return nil, s.WaitBoard(ctx, p.Owner)
+	case "SaveSyncState":
+		return nil, s.SaveSyncState(p.Username, p.Name, p.State)
+	case "LoadSyncState":
+		return s.LoadSyncState(p.Username, p.Name)
+
+	case "ShareBoard":
+		return nil, s.ShareBoard(p.Owner, p.Member, p.Role)
+	case "UnshareBoard":
+		return nil, s.UnshareBoard(p.Owner, p.Member)
+	case "Shares":
+		return s.Shares(p.Owner)
+	case "Boards":
+		return s.Boards(p.Username)
+	case "BoardMembers":
+		return s.BoardMembers(p.Owner)
+	case "BoardRole":
+		return s.BoardRole(p.Username, p.Owner)
+	case "AssignedTasks":
+		return s.AssignedTasks(p.Username)
+
+	case "Users":
+		return s.Users()
+	case "User":
+		return s.User(p.Username)
+	case "SetDisabled":
+		return nil, s.SetDisabled(p.Username, p.Disabled)
+	case "ResetPassword":
+		return s.ResetPassword(p.Username, p.Password)
+	case "RenameUser":
+		return s.RenameUser(p.Username, p.NewName)
+	case "TaskCounts":
+		return s.TaskCounts(p.Username)
+	case "Backup":
+		return backupTo(s, p.Path, p.Compress)
+	}
+	return nil, fmt.Errorf("method %q is not implemented", method)
+}
+
+// backupTo writes a backup of s to the file at path, which the client
+// created: the daemon runs on the same machine, and the backup does not
+// have to go through the connection.
+func backupTo(s *Store, path string, compress bool) (BackupManifest, error) {
+	if !filepath.IsAbs(path) {
+		return BackupManifest{}, errors.New("the path of the backup must be absolute")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer f.Close()
+	m, err := s.Backup(f, compress)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	return m, f.Close()
+}
+
+// held records that the connection signed in username, if err is nil.
+func (c *rpcConn) held(username string, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.holds[username]++
+	return username, nil
+}
+
+// lock locks username for the connection, if it signed them in.
+func (c *rpcConn) lock(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.holds[username] == 0 {
+		return
+	}
+	c.holds[username]--
+	if c.holds[username] == 0 {
+		delete(c.holds, username)
+	}
+	c.srv.store.Lock(username)
+}
@@ -0,0 +1,212 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "admin-token"
+
+// serveTestStore serves s on a Unix socket and returns its path.
+func serveTestStore(t *testing.T, s *Store) string {
+	t.Helper()
+	// Socket paths are short: t.TempDir can be too long
+	dir, err := os.MkdirTemp("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewRPCServer(s, testAdminToken)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return path
+}
+
+func dialStore(t *testing.T, path string) *RemoteStore {
+	t.Helper()
+	r, err := DialStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRPCErrors(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	r := dialStore(t, serveTestStore(t, s))
+
+	if _, err := r.AuthenticateUser("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("AuthenticateUser with a wrong password = %v, want ErrInvalidCredentials", err)
+	}
+	var locked *LockedError
+	if _, err := r.AuthenticateUser("alice", "password"); !errors.As(err, &locked) || locked.Until.IsZero() {
+		t.Errorf("AuthenticateUser while throttled = %v, want a *LockedError", err)
+	}
+	if _, err := r.CreateUser("Alice", "password"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("CreateUser of a taken name = %v, want ErrUserExists", err)
+	}
+
+	if _, err := r.CreateUser("bob", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SaveBoard("bob", "bob", boardWith(0, "first")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.SaveBoard("bob", "bob", boardWith(0, "stale"))
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Owner != "bob" || conflict.Revision != 1 {
+		t.Errorf("SaveBoard at a stale revision = %v, want a conflict at revision 1", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.WaitBoard(ctx, "bob"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitBoard = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRPCSignedInUsersOnly(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	createUser(t, s, "bob")
+	path := serveTestStore(t, s)
+	r := dialStore(t, path)
+
+	if _, err := r.LoadBoard("alice", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard before signing in = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := r.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LoadBoard("alice", "alice"); err != nil {
+		t.Errorf("LoadBoard once signed in: %v", err)
+	}
+	if _, err := r.LoadBoard("bob", "bob"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard as another user = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := r.Sessions("bob"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Sessions of another user = %v, want ErrPermissionDenied", err)
+	}
+	if err := r.ChangePassword("bob", "password", "new password"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ChangePassword of another user = %v, want ErrPermissionDenied", err)
+	}
+	if err := r.DeleteUser("bob", "password"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("DeleteUser of another user = %v, want ErrPermissionDenied", err)
+	}
+	if err := r.ShareBoard("bob", "alice", RoleEditor); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ShareBoard of another user = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := r.BoardMembers("bob"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("BoardMembers of a board not shared = %v, want ErrPermissionDenied", err)
+	}
+
+	r.Lock("alice")
+	if _, err := r.LoadBoard("alice", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard after Lock = %v, want ErrPermissionDenied", err)
+	}
+
+	// Signed in elsewhere is not signed in on this connection
+	other := dialStore(t, path)
+	if _, err := other.AuthenticateUser("bob", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LoadBoard("bob", "bob"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard of a user signed in on another connection = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestRPCAdmin(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	r := dialStore(t, serveTestStore(t, s))
+
+	if _, err := r.Users(); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Users without Admin = %v, want ErrPermissionDenied", err)
+	}
+	if err := r.SetDisabled("alice", true); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SetDisabled without Admin = %v, want ErrPermissionDenied", err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.Backup(&buf, false); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Backup without Admin = %v, want ErrPermissionDenied", err)
+	}
+	if err := r.Admin("wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Admin with a wrong token = %v, want ErrInvalidCredentials", err)
+	}
+
+	if err := r.Admin(testAdminToken); err != nil {
+		t.Fatal(err)
+	}
+	users, err := r.Users()
+	if err != nil || len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("Users = %+v, %v", users, err)
+	}
+	m, err := r.Backup(&buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Users != 1 || buf.Len() == 0 {
+		t.Errorf("Backup = %+v with %d bytes", m, buf.Len())
+	}
+	// Administrators do not act on behalf of users
+	if _, err := r.LoadBoard("alice", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("LoadBoard as an administrator = %v, want ErrPermissionDenied", err)
+	}
+}
+
+func TestRPCCloseLocks(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	s.Lock("alice")
+	r := dialStore(t, serveTestStore(t, s))
+
+	if _, err := r.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if s.dataKey("alice") == nil {
+		t.Fatal("signing in did not unlock the tasks")
+	}
+	r.Close()
+	for deadline := time.Now().Add(time.Second); s.dataKey("alice") != nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("closing the connection did not lock the tasks")
+		}
+	}
+}
+
+func TestRPCDeleteUserEndsSignIns(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	s.Lock("alice")
+	r := dialStore(t, serveTestStore(t, s))
+
+	if _, err := r.AuthenticateUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteUser("alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	// A new alice signed in elsewhere stays signed in when the connection
+	// of the deleted one closes
+	createUser(t, s, "alice")
+	r.Close()
+	time.Sleep(100 * time.Millisecond)
+	if s.dataKey("alice") == nil {
+		t.Error("closing the connection of a deleted user locked the tasks of a new one")
+	}
+}
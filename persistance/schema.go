@@ -0,0 +1,111 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// SchemaVersion is the version of the key and value layout written by this
+// build. Databases written by older builds are upgraded when opened.
+const SchemaVersion = 3
+
+var schemaKey = []byte("meta:schema")
+
+// migrations upgrade the database from the version they are indexed by to
+// the next one. Databases without a version key are version 1.
+var migrations = map[int]func(txn *badger.Txn) error{
+	1: assignTaskIDs,
+	2: canonicalizeUsernames,
+}
+
+// migrate upgrades the database to SchemaVersion in a single transaction.
+func (s *Store) migrate() error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		version, err := readSchemaVersion(txn)
+		if err != nil {
+			return err
+		}
+		if version > SchemaVersion {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, SchemaVersion)
+		}
+		for ; version < SchemaVersion; version++ {
+			if err := migrations[version](txn); err != nil {
+				return fmt.Errorf("failed to migrate schema from version %d: %w", version, err)
+			}
+		}
+		return txn.Set(schemaKey, []byte(strconv.Itoa(SchemaVersion)))
+	})
+}
+
+// checkSchema checks that a database that cannot be migrated, being open
+// read-only, is at SchemaVersion.
+func (s *Store) checkSchema() error {
+	return s.db.View(func(txn *badger.Txn) error {
+		version, err := readSchemaVersion(txn)
+		if err != nil {
+			return err
+		}
+		if version != SchemaVersion {
+			return fmt.Errorf("database schema version %d is not the supported version %d; open it once without read-only to upgrade it", version, SchemaVersion)
+		}
+		return nil
+	})
+}
+
+func readSchemaVersion(txn *badger.Txn) (int, error) {
+	item, err := txn.Get(schemaKey)
+	if err == badger.ErrKeyNotFound {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed reading schema version: %w", err)
+	}
+	var version int
+	err = item.Value(func(val []byte) error {
+		version, err = strconv.Atoi(string(val))
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version: %w", err)
+	}
+	return version, nil
+}
+
+// assignTaskIDs gives every stored task an ID (version 1 to 2).
+func assignTaskIDs(txn *badger.Txn) error {
+	updated := map[string][]byte{}
+
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("tasks:")})
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		var tasks []Task
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &tasks)
+		}); err != nil {
+			it.Close()
+			return fmt.Errorf("failed to read %s: %w", item.Key(), err)
+		}
+		for i := range tasks {
+			if tasks[i].ID == "" {
+				tasks[i].ID = NewTaskID()
+			}
+		}
+		val, err := json.Marshal(tasks)
+		if err != nil {
+			it.Close()
+			return err
+		}
+		updated[string(item.KeyCopy(nil))] = val
+	}
+	it.Close()
+
+	for key, val := range updated {
+		if err := txn.Set([]byte(key), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
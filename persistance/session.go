@@ -0,0 +1,219 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// DefaultSessionTTL is how long a remembered session lasts by default.
+const DefaultSessionTTL = 30 * 24 * time.Hour
+
+// ErrSessionInvalid is returned for a session token that is unknown, expired
+// or revoked.
+var ErrSessionInvalid = errors.New("session expired or revoked; sign in again")
+
+// Session is a remembered sign-in. Only a hash of its token is stored.
+type Session struct {
+	ID       string    `json:"-"` // short form of the token hash, for listing and revoking
+	Username string    `json:"username"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	// Key is the data key of an encrypted account, sealed with a key derived
+	// from the token, so the session can unlock the tasks without the
+	// password.
+	Key []byte `json:"key,omitempty"`
+}
+
+// sessionIDLength is the number of hex digits of the token hash in Session.ID.
+const sessionIDLength = 12
+
+// sessionKey generates the database key for the session with the given
+// token hash.
+func sessionKey(hash string) []byte {
+	return []byte("session:" + hash)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionID returns the ID of the session with the given token.
+func SessionID(token string) string {
+	return hashToken(token)[:sessionIDLength]
+}
+
+// tokenKey derives the key sealing the data key of a session from its token.
+func tokenKey(token string) []byte {
+	sum := sha256.Sum256([]byte("todo-elm session key:" + token))
+	return sum[:]
+}
+
+// CreateSession starts a session for username, who must have signed in with
+// AuthenticateUser, and returns its token.
+func (s *Store) CreateSession(username string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sess := Session{Username: username, Created: now, Expires: now.Add(ttl)}
+	err := s.update(func(txn *badger.Txn) error {
+		wk, err := readWrappedKey(txn, username)
+		if err != nil {
+			return err
+		}
+		if wk != nil {
+			key := s.dataKey(username)
+			if key == nil {
+				return ErrLocked
+			}
+			if sess.Key, err = seal(tokenKey(token), key, nil); err != nil {
+				return err
+			}
+		}
+		val, err := json.Marshal(sess)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(sessionKey(hashToken(token)), val).WithTTL(ttl))
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed saving session: %w", err)
+	}
+	return token, nil
+}
+
+// ResumeSession signs in with a session token, unlocking the tasks of an
+// encrypted account, and returns the username.
+func (s *Store) ResumeSession(token string) (string, error) {
+	var sess Session
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		sess, err = readSession(txn, hashToken(token))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(sess.Key) > 0 {
+		key, err := open(tokenKey(token), sess.Key, nil)
+		if err != nil {
+			return "", ErrSessionInvalid
+		}
+		s.setDataKey(sess.Username, key)
+	}
+	s.hold(sess.Username)
+	return sess.Username, nil
+}
+
+// EndSession revokes the session with the given token, e.g. on log out.
+func (s *Store) EndSession(token string) error {
+	return s.update(func(txn *badger.Txn) error {
+		return txn.Delete(sessionKey(hashToken(token)))
+	})
+}
+
+// Sessions returns the sessions of username, oldest first.
+func (s *Store) Sessions(username string) ([]Session, error) {
+	var sessions []Session
+	err := s.db.View(func(txn *badger.Txn) error {
+		keys, err := sessionKeys(txn, username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			sess, err := readSession(txn, strings.TrimPrefix(string(key), "session:"))
+			if err == ErrSessionInvalid {
+				continue // expired since it was listed
+			}
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, sess)
+		}
+		return nil
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	return sessions, err
+}
+
+// RevokeSession revokes the session of username with the given ID, or all of
+// their sessions if id is empty. It returns the number of sessions revoked.
+func (s *Store) RevokeSession(username, id string) (int, error) {
+	n := 0
+	err := s.update(func(txn *badger.Txn) error {
+		keys, err := sessionKeys(txn, username)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if id != "" && !strings.HasPrefix(string(key), string(sessionKey(id))) {
+				continue
+			}
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// sessionKeys returns the database keys of the sessions of username.
+func sessionKeys(txn *badger.Txn, username string) ([][]byte, error) {
+	var keys [][]byte
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("session:"), PrefetchValues: true})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		var sess Session
+		err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &sess)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid session: %w", err)
+		}
+		if sess.Username == username {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+	}
+	return keys, nil
+}
+
+func readSession(txn *badger.Txn, hash string) (Session, error) {
+	var sess Session
+	item, err := txn.Get(sessionKey(hash))
+	if err == badger.ErrKeyNotFound {
+		return sess, ErrSessionInvalid
+	}
+	if err != nil {
+		return sess, fmt.Errorf("failed retrieving session: %w", err)
+	}
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &sess)
+	}); err != nil {
+		return sess, fmt.Errorf("invalid session: %w", err)
+	}
+	if time.Now().After(sess.Expires) {
+		return sess, ErrSessionInvalid
+	}
+	sess.ID = hash[:sessionIDLength]
+	return sess, nil
+}
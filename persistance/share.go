@@ -0,0 +1,426 @@
+package persistence
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Every user owns one board, the tasks stored under their name. The owner
+// can share it with other users, who get a Role on it. For an encrypted
+// board the share carries the board's data key, sealed to a key pair of the
+// member, so the member can open it with their own password.
+
+// Role is the access a user has to a board.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor" // can change the tasks
+	RoleViewer Role = "viewer" // can only read them
+)
+
+// ParseRole returns the role a board can be shared with: "editor" or
+// "viewer".
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleEditor, RoleViewer:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown role %q (want editor or viewer)", s)
+}
+
+// CanWrite reports whether the role allows changing the tasks of a board.
+func (r Role) CanWrite() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+// ErrPermissionDenied is returned when reading a board that is not shared
+// with the user, or changing one they can only view.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Share gives Member access to the board of Owner.
+type Share struct {
+	Owner  string `json:"owner"`
+	Member string `json:"member"`
+	Role   Role   `json:"role"`
+	// Key is the data key of an encrypted board, sealed to the public key
+	// of the member.
+	Key []byte `json:"key,omitempty"`
+}
+
+// BoardRef is a board a user can open.
+type BoardRef struct {
+	Owner string
+	Role  Role
+}
+
+// boxKeys is the key pair a user receives the keys of encrypted boards
+// with. Only accounts with a data key have one.
+type boxKeys struct {
+	Public  []byte `json:"public"`
+	Private []byte `json:"private"` // sealed with the user's data key
+}
+
+// shareKey generates the database key for the share of the board of owner
+// with member.
+func shareKey(owner, member string) []byte {
+	return []byte("share:" + owner + ":" + member)
+}
+
+// boxKeysKey generates the database key for the key pair of a user.
+func boxKeysKey(username string) []byte {
+	return []byte("boxkey:" + username)
+}
+
+// ShareBoard shares the board of owner, who must be signed in, with member,
+// or changes the role of a member it is already shared with. An encrypted
+// board can only be shared with a user who has signed in since encryption
+// was turned on.
+func (s *Store) ShareBoard(owner, member string, role Role) error {
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+	member, err := NormalizeUsername(member)
+	if err != nil {
+		return err
+	}
+	if member == owner {
+		return errors.New("a board is always shared with its owner")
+	}
+	return s.update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(userKey(member)); err == badger.ErrKeyNotFound {
+			return fmt.Errorf("no user named %s", member)
+		} else if err != nil {
+			return fmt.Errorf("failed retrieving user: %w", err)
+		}
+		sh := Share{Owner: owner, Member: member, Role: role}
+		wk, err := readWrappedKey(txn, owner)
+		if err != nil {
+			return err
+		}
+		if wk != nil {
+			key := s.dataKey(owner)
+			if key == nil {
+				return ErrLocked
+			}
+			bk, err := readBoxKeys(txn, member)
+			if err != nil {
+				return err
+			}
+			if bk == nil {
+				return fmt.Errorf("%s must sign in once before an encrypted board can be shared with them", member)
+			}
+			if sh.Key, err = sealTo(bk.Public, key); err != nil {
+				return err
+			}
+		}
+		return writeShare(txn, sh)
+	})
+}
+
+// UnshareBoard stops sharing the board of owner with member. A member who
+// kept a copy of the database could still read what the board held until
+// then.
+func (s *Store) UnshareBoard(owner, member string) error {
+	if canonical, err := NormalizeUsername(member); err == nil {
+		member = canonical
+	}
+	return s.update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(shareKey(owner, member)); err == badger.ErrKeyNotFound {
+			return fmt.Errorf("the board is not shared with %s", member)
+		} else if err != nil {
+			return err
+		}
+		return txn.Delete(shareKey(owner, member))
+	})
+}
+
+// Shares returns who the board of owner is shared with, by member name.
+func (s *Store) Shares(owner string) ([]Share, error) {
+	var shares []Share
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		shares, err = readShares(txn, func(sh Share) bool { return sh.Owner == owner })
+		return err
+	})
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Member < shares[j].Member })
+	return shares, err
+}
+
+// Boards returns the boards username can open: their own, then the ones
+// shared with them by owner name.
+func (s *Store) Boards(username string) ([]BoardRef, error) {
+	boards := []BoardRef{{Owner: username, Role: RoleOwner}}
+	var shares []Share
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		shares, err = readShares(txn, func(sh Share) bool { return sh.Member == username })
+		return err
+	})
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Owner < shares[j].Owner })
+	for _, sh := range shares {
+		boards = append(boards, BoardRef{Owner: sh.Owner, Role: sh.Role})
+	}
+	return boards, err
+}
+
+// BoardMembers returns who the board of owner is shared with, owner first,
+// e.g. to assign tasks to.
+func (s *Store) BoardMembers(owner string) ([]string, error) {
+	shares, err := s.Shares(owner)
+	members := []string{owner}
+	for _, sh := range shares {
+		members = append(members, sh.Member)
+	}
+	return members, err
+}
+
+// AssignedTask is a task assigned to a user, with the board it is on.
+type AssignedTask struct {
+	Owner string
+	Task
+}
+
+// AssignedTasks returns the tasks assigned to username on every board they
+// can open, board by board and column by column. Boards that cannot be read,
+// e.g. an encrypted one its owner has not signed in to since sharing, are
+// skipped and reported in the error.
+func (s *Store) AssignedTasks(username string) ([]AssignedTask, error) {
+	boards, err := s.Boards(username)
+	if err != nil {
+		return nil, err
+	}
+	var assigned []AssignedTask
+	var errs []error
+	for _, b := range boards {
+		for _, status := range Statuses {
+			tasks, err := s.LoadBoardTasks(username, b.Owner, status)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s's board: %w", b.Owner, err))
+				break
+			}
+			for _, t := range tasks {
+				if t.Assignee == username {
+					assigned = append(assigned, AssignedTask{Owner: b.Owner, Task: t})
+				}
+			}
+		}
+	}
+	return assigned, errors.Join(errs...)
+}
+
+// BoardRole returns the role of username on the board of owner, or
+// ErrPermissionDenied if it is not shared with them.
+func (s *Store) BoardRole(username, owner string) (Role, error) {
+	var role Role
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		role, err = boardRole(txn, username, owner)
+		return err
+	})
+	return role, err
+}
+
+func boardRole(txn *badger.Txn, username, owner string) (Role, error) {
+	if username == owner {
+		return RoleOwner, nil
+	}
+	sh, err := readShare(txn, owner, username)
+	if err != nil {
+		return "", err
+	}
+	if sh == nil {
+		return "", ErrPermissionDenied
+	}
+	return sh.Role, nil
+}
+
+// boardKey returns the data key username reads and writes the board of
+// owner with, or nil if the board is not encrypted or not unlocked.
+func (s *Store) boardKey(txn *badger.Txn, username, owner string) ([]byte, error) {
+	if username == owner {
+		return s.dataKey(owner), nil
+	}
+	sh, err := readShare(txn, owner, username)
+	if err != nil {
+		return nil, err
+	}
+	if sh == nil {
+		return nil, ErrPermissionDenied
+	}
+	if len(sh.Key) == 0 {
+		// Shared before it was encrypted: sealShares adds the key when the
+		// owner next signs in
+		wk, err := readWrappedKey(txn, owner)
+		if err != nil {
+			return nil, err
+		}
+		if wk != nil {
+			return nil, fmt.Errorf("%s's board is encrypted; it can be opened once they sign in again", owner)
+		}
+		return nil, nil
+	}
+	bk, err := readBoxKeys(txn, username)
+	if err != nil || bk == nil {
+		return nil, err
+	}
+	own := s.dataKey(username)
+	if own == nil {
+		return nil, ErrLocked
+	}
+	private, err := open(own, bk.Private, nil)
+	if err != nil || len(private) != 32 {
+		return nil, fmt.Errorf("failed to open key pair: %v", err)
+	}
+	key, ok := box.OpenAnonymous(nil, sh.Key, (*[32]byte)(bk.Public), (*[32]byte)(private))
+	if !ok {
+		return nil, errors.New("failed to open the key of the shared board")
+	}
+	return key, nil
+}
+
+// ensureBoxKeys creates the key pair of username, whose data key is key, if
+// they have none.
+func ensureBoxKeys(txn *badger.Txn, username string, key []byte) error {
+	bk, err := readBoxKeys(txn, username)
+	if err != nil || bk != nil {
+		return err
+	}
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(key, private[:], nil)
+	if err != nil {
+		return err
+	}
+	val, err := json.Marshal(boxKeys{Public: public[:], Private: sealed})
+	if err != nil {
+		return err
+	}
+	return txn.Set(boxKeysKey(username), val)
+}
+
+// sealShares gives the members of the board of owner, whose data key is
+// key, the key where they have none yet: the board was shared before it
+// was encrypted, or before the member had a key pair.
+func sealShares(txn *badger.Txn, owner string, key []byte) error {
+	shares, err := readShares(txn, func(sh Share) bool { return sh.Owner == owner && len(sh.Key) == 0 })
+	if err != nil {
+		return err
+	}
+	for _, sh := range shares {
+		bk, err := readBoxKeys(txn, sh.Member)
+		if err != nil {
+			return err
+		}
+		if bk == nil {
+			continue
+		}
+		if sh.Key, err = sealTo(bk.Public, key); err != nil {
+			return err
+		}
+		if err := writeShare(txn, sh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sealTo(public, key []byte) ([]byte, error) {
+	return box.SealAnonymous(nil, key, (*[32]byte)(public), rand.Reader)
+}
+
+func readBoxKeys(txn *badger.Txn, username string) (*boxKeys, error) {
+	item, err := txn.Get(boxKeysKey(username))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving key pair: %w", err)
+	}
+	var bk boxKeys
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &bk)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid key pair: %w", err)
+	}
+	if len(bk.Public) != 32 {
+		return nil, errors.New("invalid key pair")
+	}
+	return &bk, nil
+}
+
+func readShare(txn *badger.Txn, owner, member string) (*Share, error) {
+	item, err := txn.Get(shareKey(owner, member))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving share: %w", err)
+	}
+	var sh Share
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &sh)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid share: %w", err)
+	}
+	return &sh, nil
+}
+
+// readShares returns the shares for which keep returns true.
+func readShares(txn *badger.Txn, keep func(Share) bool) ([]Share, error) {
+	var shares []Share
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("share:"), PrefetchValues: true})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		var sh Share
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &sh)
+		}); err != nil {
+			return nil, fmt.Errorf("invalid share: %w", err)
+		}
+		if keep(sh) {
+			shares = append(shares, sh)
+		}
+	}
+	return shares, nil
+}
+
+func writeShare(txn *badger.Txn, sh Share) error {
+	val, err := json.Marshal(sh)
+	if err != nil {
+		return err
+	}
+	return txn.Set(shareKey(sh.Owner, sh.Member), val)
+}
+
+// shareKeys returns the database keys of the shares of the board of
+// username and of the boards shared with them.
+func shareKeys(txn *badger.Txn, username string) ([][]byte, error) {
+	shares, err := readShares(txn, func(sh Share) bool {
+		return sh.Owner == username || sh.Member == username
+	})
+	var keys [][]byte
+	for _, sh := range shares {
+		keys = append(keys, shareKey(sh.Owner, sh.Member))
+	}
+	return keys, err
+}
+
+// renameShare returns sh with oldName replaced by newName.
+func renameShare(sh Share, oldName, newName string) Share {
+	if sh.Owner == oldName {
+		sh.Owner = newName
+	}
+	if sh.Member == oldName {
+		sh.Member = newName
+	}
+	return sh
+}
@@ -0,0 +1,39 @@
+//go:build linux || freebsd
+
+package persistence
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyData copies the first size bytes of in to out, skipping the holes of
+// in, which are left as holes in out.
+func copyData(in, out *os.File, size int64) error {
+	for off := int64(0); off < size; {
+		data, err := in.Seek(off, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// Only a hole left
+			return nil
+		}
+		end := size
+		if err != nil {
+			// Holes not supported by the file system: copy everything
+			data = off
+		} else if end, err = in.Seek(data, unix.SEEK_HOLE); errors.Is(err, unix.ENXIO) {
+			// Truncated meanwhile
+			return nil
+		} else if err != nil {
+			return err
+		}
+		end = min(end, size)
+		if _, err := io.Copy(io.NewOffsetWriter(out, data), io.NewSectionReader(in, data, end-data)); err != nil {
+			return err
+		}
+		off = end
+	}
+	return nil
+}
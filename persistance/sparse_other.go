@@ -0,0 +1,15 @@
+//go:build !linux && !freebsd
+
+package persistence
+
+import (
+	"io"
+	"os"
+)
+
+// copyData copies the first size bytes of in to out. Holes are copied as
+// zeros: the system has no portable way of finding them.
+func copyData(in, out *os.File, size int64) error {
+	_, err := io.Copy(out, io.NewSectionReader(in, 0, size))
+	return err
+}
@@ -0,0 +1,156 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/ssh"
+)
+
+// Users can sign in to the SSH server (see `todo-elm serve`) with a public
+// key instead of their password. The keys of each user are stored under
+// their name like authorized_keys lines.
+
+// AuthorizedKey is a public key a user can sign in with.
+type AuthorizedKey struct {
+	Fingerprint string    `json:"fingerprint"` // SHA256, as shown by ssh-keygen -l
+	Line        string    `json:"line"`        // in authorized_keys format
+	Comment     string    `json:"comment,omitempty"`
+	Added       time.Time `json:"added"`
+}
+
+// ErrUnknownKey is returned by RemoveAuthorizedKey for a key the user does
+// not have.
+var ErrUnknownKey = errors.New("no such key")
+
+// authorizedKeyKey generates the database key for an authorized key.
+func authorizedKeyKey(username, fingerprint string) []byte {
+	return []byte("sshkey:" + username + ":" + fingerprint)
+}
+
+// AddAuthorizedKey lets username, who must be signed in, sign in with the
+// public key in line, a line of an authorized_keys file such as the
+// contents of ~/.ssh/id_ed25519.pub.
+func (s *Store) AddAuthorizedKey(username, line string) (AuthorizedKey, error) {
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return AuthorizedKey{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	ak := AuthorizedKey{
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		Line:        strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+		Comment:     comment,
+		Added:       time.Now().UTC().Truncate(time.Second),
+	}
+	val, err := json.Marshal(ak)
+	if err != nil {
+		return ak, err
+	}
+	err = s.update(func(txn *badger.Txn) error {
+		return txn.Set(authorizedKeyKey(username, ak.Fingerprint), val)
+	})
+	return ak, err
+}
+
+// AuthorizedKeys returns the public keys username can sign in with, oldest
+// first.
+func (s *Store) AuthorizedKeys(username string) ([]AuthorizedKey, error) {
+	var keys []AuthorizedKey
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, key := range authorizedKeyKeys(txn, username) {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			var ak AuthorizedKey
+			if err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &ak)
+			}); err != nil {
+				return fmt.Errorf("invalid authorized key: %w", err)
+			}
+			keys = append(keys, ak)
+		}
+		return nil
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Added.Before(keys[j].Added)
+	})
+	return keys, err
+}
+
+// RemoveAuthorizedKey stops username from signing in with the key with the
+// given fingerprint.
+func (s *Store) RemoveAuthorizedKey(username, fingerprint string) error {
+	return s.update(func(txn *badger.Txn) error {
+		key := authorizedKeyKey(username, fingerprint)
+		if _, err := txn.Get(key); err == badger.ErrKeyNotFound {
+			return fmt.Errorf("%w: %s", ErrUnknownKey, fingerprint)
+		} else if err != nil {
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+// KeyAuthorized reports whether username can sign in with pub, without
+// signing them in, and returns their stored name. The tasks of encrypted
+// accounts can only be unlocked with the password, so they cannot sign in
+// with a key: ErrLocked is returned for them.
+func (s *Store) KeyAuthorized(username string, pub ssh.PublicKey) (string, error) {
+	username, err := s.resolveUsername(username)
+	if err != nil {
+		return "", err
+	}
+	err = s.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(authorizedKeyKey(username, ssh.FingerprintSHA256(pub))); err == badger.ErrKeyNotFound {
+			return ErrInvalidCredentials
+		} else if err != nil {
+			return fmt.Errorf("failed retrieving key: %w", err)
+		}
+		disabled, err := isDisabled(txn, username)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			return ErrAccountDisabled
+		}
+		wk, err := readWrappedKey(txn, username)
+		if err != nil {
+			return err
+		}
+		if wk != nil {
+			return ErrLocked
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return username, nil
+}
+
+// AuthenticateKey signs in username with the public key pub, see
+// KeyAuthorized, and returns their stored name.
+func (s *Store) AuthenticateKey(username string, pub ssh.PublicKey) (string, error) {
+	username, err := s.KeyAuthorized(username, pub)
+	if err != nil {
+		return "", err
+	}
+	if err := s.clearFailures(username); err != nil {
+		return "", err
+	}
+	s.hold(username)
+	return username, nil
+}
+
+// authorizedKeyKeys returns the database keys of the authorized keys of
+// username.
+func authorizedKeyKeys(txn *badger.Txn, username string) [][]byte {
+	// Fingerprints are "SHA256:..."
+	return userKeys(txn, "sshkey", username, 2)
+}
@@ -1,15 +1,19 @@
 package persistence
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // TaskStatus represents the status of a task
@@ -21,39 +25,166 @@ const (
 	Done
 )
 
+// Statuses lists every task status in board order.
+var Statuses = []TaskStatus{Todo, InProgress, Done}
+
+// String returns the name of the status as used in config and export files.
+func (s TaskStatus) String() string {
+	switch s {
+	case Todo:
+		return "todo"
+	case InProgress:
+		return "in_progress"
+	case Done:
+		return "done"
+	}
+	return fmt.Sprintf("TaskStatus(%d)", int(s))
+}
+
+// ParseTaskStatus returns the status named by s, as returned by String.
+func ParseTaskStatus(s string) (TaskStatus, error) {
+	for _, status := range Statuses {
+		if status.String() == s {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown task status %q", s)
+}
+
 // Task represents a to-do task that can be persisted
 type Task struct {
+	ID          string     `json:"id,omitempty"`
 	Status      TaskStatus `json:"status"`
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
+	// Priority is a letter from "A" (highest) to "Z", or empty for none.
+	Priority string `json:"priority,omitempty"`
+	// Tags keep the sigil of todo.txt projects ("+garden") and contexts
+	// ("@phone"); other tags have none.
+	Tags      []string   `json:"tags,omitempty"`
+	Due       *time.Time `json:"due,omitempty"`
+	Created   *time.Time `json:"created,omitempty"`
+	Completed *time.Time `json:"completed,omitempty"`
+	// Assignee is the member of the board the task is assigned to, if any.
+	Assignee string `json:"assignee,omitempty"`
+}
+
+// NewTaskID returns a random UUID (version 4) identifying a task.
+func NewTaskID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // ErrUserExists is returned when trying to create a user that already exists.
 var ErrUserExists = errors.New("user already exists")
 
+// ErrInvalidCredentials is returned when a username or password is wrong.
+// It does not tell which, on purpose.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
 // Store manages the BadgerDB connection and operations.
 type Store struct {
-	db *badger.DB
+	db      *badger.DB
+	encrypt bool // encrypt accounts without a data key, see EnableEncryption
+
+	maxAttempts int           // failed sign-ins before a lockout, see SetThrottle
+	lockout     time.Duration // first lockout
+
+	hashAlgorithm string // see SetHashing
+	bcryptCost    int
+
+	readOnly bool      // see NewReadOnlyStore
+	snapshot string    // directory of the copy of the database open, if any
+	taken    time.Time // when the copy was made
+
+	mu    sync.Mutex
+	keys  map[string][]byte // unlocked data keys by username
+	holds map[string]int    // sign-ins by username not locked yet, see Lock
+
+	attempts map[string]*attempt // sign-in attempts by username, see beginAttempt
+}
+
+// DBDir returns the database directory inside baseDir.
+func DBDir(baseDir string) string {
+	return filepath.Join(baseDir, "badger")
 }
 
 // NewStore initializes and returns a new Store instance.
 // It creates the database directory if it doesn't exist.
 func NewStore(baseDir string) (*Store, error) {
-	dbDir := filepath.Join(baseDir, "badger") // Store DB in a subdir
+	dbDir := DBDir(baseDir) // Store DB in a subdir
 	if err := os.MkdirAll(dbDir, 0777); err != nil {
 		return nil, fmt.Errorf("failed to create BadgerDB directory %s: %w", dbDir, err)
 	}
 	log.Printf("BadgerDB directory: %s\n", dbDir)
 
+	db, err := openDB(dbDir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ErrInUse is matched by an *InUseError with errors.Is.
+var ErrInUse = errors.New("the database is in use by another process")
+
+// InUseError is returned by NewStore when another process has the database
+// open: only one process at a time can.
+type InUseError struct {
+	PID int // of the process, or 0 if unknown
+}
+
+func (e *InUseError) Error() string {
+	if e.PID == 0 {
+		return ErrInUse.Error()
+	}
+	return fmt.Sprintf("%v (pid %d)", ErrInUse, e.PID)
+}
+
+func (e *InUseError) Is(target error) bool {
+	return target == ErrInUse
+}
+
+// lockHolder returns the pid BadgerDB wrote in dbDir for the process that has
+// it open, or 0 if it cannot be read.
+func lockHolder(dbDir string) int {
+	data, err := os.ReadFile(filepath.Join(dbDir, "LOCK"))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// openDB opens the BadgerDB database in dbDir. It returns an *InUseError if
+// another process has it open.
+func openDB(dbDir string, readOnly bool) (*badger.DB, error) {
 	opts := badger.DefaultOptions(dbDir)
 	opts.Logger = nil
+	opts.ReadOnly = readOnly
 
 	db, err := badger.Open(opts)
 	if err != nil {
+		if strings.Contains(err.Error(), "Cannot acquire directory lock") {
+			return nil, &InUseError{PID: lockHolder(dbDir)}
+		}
 		return nil, fmt.Errorf("failed to open BadgerDB: %w", err)
 	}
-
-	return &Store{db: db}, nil
+	return db, nil
 }
 
 // Close closes the underlying BadgerDB database.
@@ -61,7 +192,13 @@ func (s *Store) Close() error {
 	if s.db == nil {
 		return nil
 	}
-	return s.db.Close()
+	err := s.db.Close()
+	if s.snapshot != "" {
+		if rerr := os.RemoveAll(s.snapshot); err == nil {
+			err = rerr
+		}
+	}
+	return err
 }
 
 // userKey generates the database key for a user.
@@ -71,17 +208,25 @@ func userKey(username string) []byte {
 
 // CreateUser attempts to create a new user in the database.
 // It hashes the password before storing.
-// Returns ErrUserExists if the username is already taken.
-func (s *Store) CreateUser(username, password string) error {
+// The username is stored in its canonical form, see NormalizeUsername,
+// which is returned. Returns ErrUserExists if the username is already
+// taken, or ErrUsernameConfusable if it looks like a taken one.
+func (s *Store) CreateUser(username, password string) (string, error) {
+	username, err := NormalizeUsername(username)
+	if err != nil {
+		return "", err
+	}
+
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hashPassword(password)
 	if err != nil {
-		return fmt.Errorf("could not hash password: %w", err)
+		return "", fmt.Errorf("could not hash password: %w", err)
 	}
 
 	key := userKey(username)
 
-	err = s.db.Update(func(txn *badger.Txn) error {
+	var dataKey []byte
+	err = s.update(func(txn *badger.Txn) error {
 		// 1. Check if user already exists
 		_, err = txn.Get(key)
 		if err == nil {
@@ -92,29 +237,95 @@ func (s *Store) CreateUser(username, password string) error {
 			// Different error occurred during Get
 			return fmt.Errorf("failed checking username: %w", err)
 		}
+		if confusableUser(txn, username, "") != "" {
+			return ErrUsernameConfusable
+		}
 
 		// 2. Key not found, safe to set the new user data
 		err = txn.Set(key, hashedPassword)
 		if err != nil {
 			return fmt.Errorf("failed saving user: %w", err)
 		}
+		if s.encrypt {
+			if dataKey, err = createDataKey(txn, username, password); err != nil {
+				return fmt.Errorf("failed creating data key: %w", err)
+			}
+		}
 		return nil // Commit transaction
 	})
-
-	return err // Return the result of the transaction (nil, ErrUserExists, or other error)
+	if err != nil {
+		return "", err // ErrUserExists, ErrUsernameConfusable or another error
+	}
+	// The new user is signed in
+	if dataKey != nil {
+		s.setDataKey(username, dataKey)
+	}
+	s.hold(username)
+	return username, nil
 }
 
 // AuthenticateUser checks if the username exists and the password is correct.
-// Returns the username on success, or an error otherwise.
+// Returns the stored username on success, which is the canonical form of
+// username (see NormalizeUsername), or an error otherwise.
+// Failed attempts are throttled per username, see SetThrottle; while a
+// username is throttled a *LockedError is returned. Users with two-factor
+// authentication get ErrSecondFactorRequired and must sign in with
+// AuthenticateUserWithCode instead.
 func (s *Store) AuthenticateUser(username, password string) (string, error) {
+	username, done, err := s.checkPassword(username, password)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	enabled, err := s.TOTPEnabled(username)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		return "", ErrSecondFactorRequired
+	}
+	if err := s.signIn(username, password); err != nil {
+		return "", err
+	}
+	s.hold(username)
+
+	// Authentication successful
+	return username, nil
+}
+
+// checkPassword checks the password of username, counting failures for
+// throttling, and returns the stored name of the user. On success, the
+// attempt goes on until the returned function is called: further attempts
+// for the user wait until then, see beginAttempt.
+func (s *Store) checkPassword(username, password string) (string, func(), error) {
+	username, err := s.resolveUsername(username)
+	if err != nil {
+		return "", nil, err
+	}
+	done := s.beginAttempt(username)
+	if err := s.verifyPassword(username, password); err != nil {
+		done()
+		return "", nil, err
+	}
+	return username, done, nil
+}
+
+// verifyPassword checks the password of username, a stored name, during an
+// attempt to sign in.
+func (s *Store) verifyPassword(username, password string) error {
+	if err := s.checkThrottle(username); err != nil {
+		return err
+	}
+
 	key := userKey(username)
 	var hashedPassword []byte
+	var disabled bool
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
 		if err != nil {
 			if err == badger.ErrKeyNotFound {
-				return errors.New("invalid username or password") // Generic error for security
+				return ErrInvalidCredentials // Generic error for security
 			}
 			return fmt.Errorf("failed retrieving user: %w", err)
 		}
@@ -128,22 +339,42 @@ func (s *Store) AuthenticateUser(username, password string) (string, error) {
 		if err != nil {
 			return fmt.Errorf("failed reading password hash: %w", err)
 		}
-		return nil
+		disabled, err = isDisabled(txn, username)
+		return err
 	})
 
-	if err != nil {
-		return "", err // Return error from View transaction (e.g., user not found)
+	if err == nil {
+		// Compare the provided password with the stored hash
+		if !comparePassword(hashedPassword, []byte(password)) {
+			// Passwords don't match, or the hash is invalid
+			err = ErrInvalidCredentials // Generic error for security
+		} else if disabled {
+			err = ErrAccountDisabled
+		} else if s.needsRehash(hashedPassword) {
+			// Upgrade the hash to the configured algorithm and cost
+			err = s.rehash(username, password)
+		}
 	}
-
-	// Compare the provided password with the stored hash
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
-	if err != nil {
-		// Passwords don't match (bcrypt.ErrMismatchedHashAndPassword) or other bcrypt error
-		return "", errors.New("invalid username or password") // Generic error for security
+	if err == ErrInvalidCredentials {
+		// Unknown users are throttled too, so lockouts don't tell which exist
+		if lerr := s.recordFailure(username); lerr != nil {
+			return lerr
+		}
 	}
+	return err
+}
 
-	// Authentication successful
-	return username, nil
+// signIn completes a successful authentication: failures are forgotten and
+// the user's tasks unlocked.
+func (s *Store) signIn(username, password string) error {
+	if err := s.clearFailures(username); err != nil {
+		return err
+	}
+	// Unlock (or set up) the encryption of the user's tasks
+	if err := s.unlock(username, password); err != nil {
+		return fmt.Errorf("failed unlocking tasks: %w", err)
+	}
+	return nil
 }
 
 // taskKey generates the database key for a task.
@@ -152,8 +383,27 @@ func taskKey(username string, status TaskStatus) []byte {
 }
 
 // SaveTasks saves the tasks for a specific user and status.
+// Tasks without an ID are given one.
 func (s *Store) SaveTasks(username string, status TaskStatus, tasks []Task) error {
-	key := taskKey(username, status)
+	return s.SaveBoardTasks(username, username, status, tasks)
+}
+
+// LoadTasks loads the tasks for a specific user and status.
+func (s *Store) LoadTasks(username string, status TaskStatus) ([]Task, error) {
+	return s.LoadBoardTasks(username, username, status)
+}
+
+// SaveBoardTasks saves the tasks of the board of owner for a status on
+// behalf of username, who must own the board or be one of its editors,
+// whatever its revision: SaveBoard only saves changes made to the current
+// revision. Tasks without an ID are given one.
+func (s *Store) SaveBoardTasks(username, owner string, status TaskStatus, tasks []Task) error {
+	key := taskKey(owner, status)
+	for i := range tasks {
+		if tasks[i].ID == "" {
+			tasks[i].ID = NewTaskID()
+		}
+	}
 
 	// Convert tasks to JSON
 	tasksJSON, err := json.Marshal(tasks)
@@ -161,32 +411,49 @@ func (s *Store) SaveTasks(username string, status TaskStatus, tasks []Task) erro
 		return fmt.Errorf("failed to marshal tasks: %w", err)
 	}
 
-	err = s.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(key, tasksJSON)
-	})
-
-	return err
+	save := func(txn *badger.Txn) error {
+		role, err := boardRole(txn, username, owner)
+		if err != nil {
+			return err
+		}
+		if !role.CanWrite() {
+			return ErrPermissionDenied
+		}
+		val, err := s.sealValue(txn, username, owner, key, tasksJSON)
+		if err != nil {
+			return err
+		}
+		if err := txn.Set(key, val); err != nil {
+			return err
+		}
+		_, err = bumpRevision(txn, owner)
+		return err
+	}
+	// The revision is read, so saving at the same time as someone else
+	// conflicts; the columns are replaced anyway, so it is retried.
+	for attempt := 0; ; attempt++ {
+		err = s.update(save)
+		if !errors.Is(err, badger.ErrConflict) || attempt == maxSaveAttempts {
+			return err
+		}
+	}
 }
 
-// LoadTasks loads the tasks for a specific user and status.
-func (s *Store) LoadTasks(username string, status TaskStatus) ([]Task, error) {
-	key := taskKey(username, status)
-	var tasks []Task
+// maxSaveAttempts is how many times SaveBoardTasks retries a save that
+// conflicted with another one.
+const maxSaveAttempts = 3
 
+// LoadBoardTasks loads the tasks of the board of owner for a status on
+// behalf of username, who must own the board or have it shared with them.
+func (s *Store) LoadBoardTasks(username, owner string, status TaskStatus) ([]Task, error) {
+	var tasks []Task
 	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			if err == badger.ErrKeyNotFound {
-				// No tasks found, return empty slice
-				tasks = []Task{}
-				return nil
-			}
-			return fmt.Errorf("failed retrieving tasks: %w", err)
+		if _, err := boardRole(txn, username, owner); err != nil {
+			return err
 		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &tasks)
-		})
+		var err error
+		tasks, err = s.readTasks(txn, username, owner, status)
+		return err
 	})
 
 	if err != nil {
@@ -195,3 +462,26 @@ func (s *Store) LoadTasks(username string, status TaskStatus) ([]Task, error) {
 
 	return tasks, nil
 }
+
+// readTasks reads the tasks of the board of owner for a status on behalf of
+// username, whose access has been checked.
+func (s *Store) readTasks(txn *badger.Txn, username, owner string, status TaskStatus) ([]Task, error) {
+	item, err := txn.Get(taskKey(owner, status))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			// No tasks found, return empty slice
+			return []Task{}, nil
+		}
+		return nil, fmt.Errorf("failed retrieving tasks: %w", err)
+	}
+
+	var tasks []Task
+	err = item.Value(func(val []byte) error {
+		val, err := s.openValue(txn, username, owner, taskKey(owner, status), val)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(val, &tasks)
+	})
+	return tasks, err
+}
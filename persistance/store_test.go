@@ -0,0 +1,36 @@
+package persistence
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestStore opens a store in a temporary directory, closed at the end
+// of the test, hashing passwords quickly.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetHashing(HashBcrypt, bcrypt.MinCost)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// createUser creates a user with the password "password".
+func createUser(t *testing.T, s *Store, username string) {
+	t.Helper()
+	if _, err := s.CreateUser(username, "password"); err != nil {
+		t.Fatalf("CreateUser(%q): %v", username, err)
+	}
+}
@@ -0,0 +1,51 @@
+package persistence
+
+import (
+	"fmt"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// syncStateKey generates the database key for the state a sync with an
+// external file keeps between runs.
+func syncStateKey(username, name string) []byte {
+	return []byte(fmt.Sprintf("sync:%s:%s", username, name))
+}
+
+// SaveSyncState stores the state of the named sync for a user. The name
+// cannot contain ':', which separates the parts of the key.
+func (s *Store) SaveSyncState(username, name string, state []byte) error {
+	if name == "" || strings.Contains(name, ":") {
+		return fmt.Errorf("invalid sync name %q", name)
+	}
+	return s.update(func(txn *badger.Txn) error {
+		val, err := s.sealValue(txn, username, username, syncStateKey(username, name), state)
+		if err != nil {
+			return err
+		}
+		return txn.Set(syncStateKey(username, name), val)
+	})
+}
+
+// LoadSyncState returns the state of the named sync for a user, or nil if
+// the sync never ran.
+func (s *Store) LoadSyncState(username, name string) ([]byte, error) {
+	var state []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(syncStateKey(username, name))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed retrieving sync state: %w", err)
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		state, err = s.openValue(txn, username, username, syncStateKey(username, name), val)
+		return err
+	})
+	return state, err
+}
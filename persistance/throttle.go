@@ -0,0 +1,187 @@
+package persistence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Default sign-in throttling, see SetThrottle.
+const (
+	DefaultMaxAttempts = 5
+	DefaultLockout     = 15 * time.Minute
+	maxLockout         = 24 * time.Hour
+)
+
+// LockedError is returned by AuthenticateUser while a username is throttled
+// after failed attempts. The password is not checked.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	wait := time.Until(e.Until).Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return fmt.Sprintf("too many failed attempts; try again in %s", wait)
+}
+
+// authFailures is the stored record of the failed attempts of a username.
+type authFailures struct {
+	Count int       `json:"count"`
+	Until time.Time `json:"until"` // no attempt is allowed before
+}
+
+// authFailKey generates the database key for the failed attempts of a user.
+func authFailKey(username string) []byte {
+	return []byte("authfail:" + username)
+}
+
+// SetThrottle configures sign-in throttling. Each failed attempt doubles the
+// wait before the next one is allowed, starting at one second; after
+// maxAttempts failures the username is locked out for lockout, doubling with
+// every further failure. Failures are forgotten after a successful sign in,
+// or once lockout has passed without any.
+func (s *Store) SetThrottle(maxAttempts int, lockout time.Duration) {
+	s.maxAttempts = maxAttempts
+	s.lockout = lockout
+}
+
+// attempt is a sign-in attempt in progress for a username.
+type attempt struct {
+	mu      sync.Mutex
+	waiting int // attempts in progress or waiting for mu
+}
+
+// beginAttempt waits for the other attempts to sign in as username to end,
+// and returns a function ending this one. Checking a password takes a
+// while, and attempts made at once would otherwise all pass checkThrottle
+// before any failure is recorded.
+func (s *Store) beginAttempt(username string) func() {
+	s.mu.Lock()
+	if s.attempts == nil {
+		s.attempts = map[string]*attempt{}
+	}
+	a := s.attempts[username]
+	if a == nil {
+		a = &attempt{}
+		s.attempts[username] = a
+	}
+	a.waiting++
+	s.mu.Unlock()
+
+	a.mu.Lock()
+	return func() {
+		a.mu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if a.waiting--; a.waiting == 0 {
+			delete(s.attempts, username)
+		}
+	}
+}
+
+// checkThrottle returns a *LockedError if username may not try to sign in yet.
+func (s *Store) checkThrottle(username string) error {
+	var f authFailures
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		f, err = readAuthFailures(txn, username)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(f.Until) {
+		return &LockedError{Until: f.Until}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt for username and returns the
+// resulting lockout, if any.
+func (s *Store) recordFailure(username string) error {
+	if s.readOnly {
+		// Whoever can read the database can try passwords against it anyway
+		return nil
+	}
+	var f authFailures
+	err := s.db.Update(func(txn *badger.Txn) error {
+		var err error
+		if f, err = readAuthFailures(txn, username); err != nil {
+			return err
+		}
+		f.Count++
+		f.Until = time.Now().Add(s.backoff(f.Count))
+		val, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		ttl := time.Until(f.Until) + s.lockoutOrDefault()
+		return txn.SetEntry(badger.NewEntry(authFailKey(username), val).WithTTL(ttl))
+	})
+	if err != nil {
+		return err
+	}
+	if f.Count >= s.maxAttemptsOrDefault() {
+		return &LockedError{Until: f.Until}
+	}
+	return nil
+}
+
+// clearFailures forgets the failed attempts of username.
+func (s *Store) clearFailures(username string) error {
+	if s.readOnly {
+		return nil
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(authFailKey(username))
+	})
+}
+
+// backoff returns how long to wait after the given number of failures.
+func (s *Store) backoff(failures int) time.Duration {
+	maxAttempts := s.maxAttemptsOrDefault()
+	wait := time.Second
+	if failures >= maxAttempts {
+		wait = s.lockoutOrDefault()
+		failures -= maxAttempts - 1
+	}
+	for i := 1; i < failures && wait < maxLockout; i++ {
+		wait *= 2
+	}
+	return min(wait, maxLockout)
+}
+
+func (s *Store) maxAttemptsOrDefault() int {
+	if s.maxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return s.maxAttempts
+}
+
+func (s *Store) lockoutOrDefault() time.Duration {
+	if s.lockout <= 0 {
+		return DefaultLockout
+	}
+	return s.lockout
+}
+
+func readAuthFailures(txn *badger.Txn, username string) (authFailures, error) {
+	var f authFailures
+	item, err := txn.Get(authFailKey(username))
+	if err == badger.ErrKeyNotFound {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed retrieving sign-in attempts: %w", err)
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &f)
+	})
+	return f, err
+}
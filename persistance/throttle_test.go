@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestThrottleParallelAttempts(t *testing.T) {
+	s := newTestStore(t)
+	// Slow enough for the attempts to overlap
+	s.SetHashing(HashBcrypt, bcrypt.DefaultCost)
+	createUser(t, s, "alice")
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.AuthenticateUser("alice", "wrong")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	checked := 0
+	for err := range errs {
+		var locked *LockedError
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			checked++
+		case !errors.As(err, &locked):
+			t.Errorf("AuthenticateUser = %v, want ErrInvalidCredentials or a *LockedError", err)
+		}
+	}
+	// The first failure makes the others wait a second
+	if checked != 1 {
+		t.Errorf("%d of %d parallel attempts had their password checked, want 1", checked, attempts)
+	}
+}
+
+func TestThrottleCorrectPasswordWhileLocked(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	if _, err := s.AuthenticateUser("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("AuthenticateUser = %v, want ErrInvalidCredentials", err)
+	}
+	var locked *LockedError
+	if _, err := s.AuthenticateUser("alice", "password"); !errors.As(err, &locked) {
+		t.Fatalf("AuthenticateUser while throttled = %v, want a *LockedError", err)
+	}
+}
@@ -0,0 +1,299 @@
+package persistence
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Two-factor authentication uses time-based one-time passwords (RFC 6238)
+// with the parameters every authenticator app supports: HMAC-SHA1, 6 digits
+// and a 30 second step.
+const (
+	totpDigits      = 6
+	totpModulus     = 1_000_000 // 10^totpDigits
+	totpStep        = 30 * time.Second
+	totpSkew        = 1 // steps accepted before and after the current one
+	totpSecretBytes = 20
+	totpIssuer      = "todo-elm"
+	recoveryCodes   = 10
+)
+
+// ErrSecondFactorRequired is returned by AuthenticateUser for users with
+// two-factor authentication; sign in with AuthenticateUserWithCode.
+var ErrSecondFactorRequired = errors.New("authentication code required")
+
+// ErrInvalidCode is returned for a wrong authentication or recovery code.
+var ErrInvalidCode = errors.New("invalid authentication code")
+
+// TOTPEnrollment is a secret waiting to be confirmed by ConfirmTOTP.
+type TOTPEnrollment struct {
+	Secret string // base32, for typing into an authenticator app
+	URI    string // otpauth:// URI, for a QR code
+}
+
+// totpState is the stored two-factor state of a user.
+type totpState struct {
+	Secret   []byte   `json:"secret"`
+	Enabled  bool     `json:"enabled"`             // false while the enrollment is pending
+	LastStep int64    `json:"last_step,omitempty"` // codes can only be used once
+	Recovery []string `json:"recovery,omitempty"`  // SHA-256 of the unused recovery codes
+}
+
+// totpKey generates the database key for the two-factor state of a user.
+func totpKey(username string) []byte {
+	return []byte("totp:" + username)
+}
+
+// TOTPEnabled reports whether username has two-factor authentication.
+func (s *Store) TOTPEnabled(username string) (bool, error) {
+	var st *totpState
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		st, err = readTOTP(txn, username)
+		return err
+	})
+	return st != nil && st.Enabled, err
+}
+
+// AuthenticateUserWithCode signs in a user with two-factor authentication,
+// checking the password and then code, an authentication code or one of the
+// recovery codes. Wrong codes count as failed attempts.
+func (s *Store) AuthenticateUserWithCode(username, password, code string) (string, error) {
+	username, done, err := s.checkPassword(username, password)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+	if err := s.checkCode(username, code); err != nil {
+		return "", err
+	}
+	if err := s.signIn(username, password); err != nil {
+		return "", err
+	}
+	s.hold(username)
+	return username, nil
+}
+
+// checkCode uses code, an authentication code or a recovery code of
+// username, counting a wrong one as a failed attempt.
+func (s *Store) checkCode(username, code string) error {
+	err := s.useCode(username, code)
+	if err == ErrInvalidCode {
+		if lerr := s.recordFailure(username); lerr != nil {
+			return lerr
+		}
+	}
+	return err
+}
+
+// BeginTOTP starts enrolling username, who must be signed in, in two-factor
+// authentication. It is not enabled until ConfirmTOTP.
+func (s *Store) BeginTOTP(username string) (TOTPEnrollment, error) {
+	var e TOTPEnrollment
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return e, err
+	}
+	err := s.update(func(txn *badger.Txn) error {
+		st, err := readTOTP(txn, username)
+		if err != nil {
+			return err
+		}
+		if st != nil && st.Enabled {
+			return errors.New("two-factor authentication is already enabled")
+		}
+		return writeTOTP(txn, username, &totpState{Secret: secret})
+	})
+	if err != nil {
+		return e, err
+	}
+	e.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	e.URI = (&url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + totpIssuer + ":" + username,
+		RawQuery: url.Values{
+			"secret": {e.Secret},
+			"issuer": {totpIssuer},
+		}.Encode(),
+	}).String()
+	return e, nil
+}
+
+// ConfirmTOTP enables the pending enrollment of username once code shows the
+// authenticator app has the secret. It returns single-use recovery codes,
+// which are only stored hashed.
+func (s *Store) ConfirmTOTP(username, code string) ([]string, error) {
+	var codes []string
+	err := s.update(func(txn *badger.Txn) error {
+		st, err := readTOTP(txn, username)
+		if err != nil {
+			return err
+		}
+		if st == nil || st.Enabled {
+			return errors.New("no two-factor enrollment in progress")
+		}
+		step, ok := st.verify(code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+		st.Enabled = true
+		st.LastStep = step
+		for range recoveryCodes {
+			c, err := newRecoveryCode()
+			if err != nil {
+				return err
+			}
+			codes = append(codes, c)
+			st.Recovery = append(st.Recovery, hashRecoveryCode(c))
+		}
+		return writeTOTP(txn, username, st)
+	})
+	return codes, err
+}
+
+// DisableTOTP turns off two-factor authentication for username after
+// checking their password and a code. It does not sign them in.
+func (s *Store) DisableTOTP(username, password, code string) error {
+	username, done, err := s.checkPassword(username, password)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := s.checkCode(username, code); err != nil {
+		return err
+	}
+	if err := s.clearFailures(username); err != nil {
+		return err
+	}
+	return s.update(func(txn *badger.Txn) error {
+		return txn.Delete(totpKey(username))
+	})
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of username.
+func (s *Store) RecoveryCodesLeft(username string) (int, error) {
+	var st *totpState
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		st, err = readTOTP(txn, username)
+		return err
+	})
+	if st == nil {
+		return 0, err
+	}
+	return len(st.Recovery), err
+}
+
+// useCode checks code for username and uses it up. Users without two-factor
+// authentication need no code. A read-only store accepts authentication
+// codes without recording them and refuses recovery codes.
+func (s *Store) useCode(username, code string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		st, err := readTOTP(txn, username)
+		if err != nil {
+			return err
+		}
+		if st == nil || !st.Enabled {
+			return nil
+		}
+		if step, ok := st.verify(code, time.Now()); ok && step > st.LastStep {
+			if s.readOnly {
+				return nil
+			}
+			st.LastStep = step
+			return writeTOTP(txn, username, st)
+		}
+		hash := hashRecoveryCode(code)
+		for i, h := range st.Recovery {
+			if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				if s.readOnly {
+					return ErrReadOnly
+				}
+				st.Recovery = append(st.Recovery[:i], st.Recovery[i+1:]...)
+				return writeTOTP(txn, username, st)
+			}
+		}
+		return ErrInvalidCode
+	})
+}
+
+// verify reports whether code is valid at now, and for which time step.
+func (st *totpState) verify(code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpStep/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(st.Secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code of a time step (RFC 4226 section 5.3).
+func totpCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%totpModulus)
+}
+
+// newRecoveryCode returns a random code such as "3f9c-a17b-22d0".
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	h := hex.EncodeToString(b)
+	return h[0:4] + "-" + h[4:8] + "-" + h[8:12], nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func readTOTP(txn *badger.Txn, username string) (*totpState, error) {
+	item, err := txn.Get(totpKey(username))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving two-factor state: %w", err)
+	}
+	var st totpState
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &st)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid two-factor state: %w", err)
+	}
+	return &st, nil
+}
+
+func writeTOTP(txn *badger.Txn, username string, st *totpState) error {
+	val, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return txn.Set(totpKey(username), val)
+}
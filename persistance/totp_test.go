@@ -0,0 +1,112 @@
+package persistence
+
+import (
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 at T = 59s, truncated to 6 digits
+	if got := totpCode([]byte("12345678901234567890"), 59/30); got != "287082" {
+		t.Errorf("totpCode = %s, want 287082", got)
+	}
+}
+
+func TestTOTPVerifySkew(t *testing.T) {
+	st := &totpState{Secret: []byte("12345678901234567890")}
+	now := time.Unix(1_700_000_000, 0)
+	current := now.Unix() / 30
+	for offset := int64(-2); offset <= 2; offset++ {
+		step, ok := st.verify(totpCode(st.Secret, current+offset), now)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want || ok && step != current+offset {
+			t.Errorf("verify of the code %d steps away = %d, %v, want %v", offset, step, ok, want)
+		}
+	}
+
+	code := totpCode(st.Secret, current)
+	if _, ok := st.verify(" "+code[:3]+" "+code[3:]+" ", now); !ok {
+		t.Error("verify of a code with spaces failed")
+	}
+	for _, code := range []string{"", "12345", "1234567", code[:5] + "x"} {
+		if _, ok := st.verify(code, now); ok {
+			t.Errorf("verify(%q) succeeded", code)
+		}
+	}
+}
+
+// enableTOTP turns on two-factor authentication for username and returns
+// its secret and recovery codes. The current time step is used up.
+func enableTOTP(t *testing.T, s *Store, username string) ([]byte, []string) {
+	t.Helper()
+	e, err := s.BeginTOTP(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(e.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.ConfirmTOTP(username, totpCode(secret, time.Now().Unix()/30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodes {
+		t.Fatalf("ConfirmTOTP returned %d recovery codes, want %d", len(codes), recoveryCodes)
+	}
+	return secret, codes
+}
+
+func TestTOTPCodeUsedOnce(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	secret, _ := enableTOTP(t, s, "alice")
+
+	if _, err := s.AuthenticateUser("alice", "password"); !errors.Is(err, ErrSecondFactorRequired) {
+		t.Fatalf("AuthenticateUser = %v, want ErrSecondFactorRequired", err)
+	}
+	// The step used to confirm cannot be used again, the next one can once
+	next := totpCode(secret, time.Now().Unix()/30+1)
+	if _, err := s.AuthenticateUserWithCode("alice", "password", next); err != nil {
+		t.Fatalf("AuthenticateUserWithCode: %v", err)
+	}
+	if _, err := s.AuthenticateUserWithCode("alice", "password", next); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("AuthenticateUserWithCode with a used code = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestTOTPRecoveryCodes(t *testing.T) {
+	s := newTestStore(t)
+	createUser(t, s, "alice")
+	_, codes := enableTOTP(t, s, "alice")
+
+	if _, err := s.AuthenticateUserWithCode("alice", "password", codes[0]); err != nil {
+		t.Fatalf("AuthenticateUserWithCode with a recovery code: %v", err)
+	}
+	if n, err := s.RecoveryCodesLeft("alice"); err != nil || n != recoveryCodes-1 {
+		t.Errorf("RecoveryCodesLeft = %d, %v, want %d", n, err, recoveryCodes-1)
+	}
+	if _, err := s.AuthenticateUserWithCode("alice", "password", codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("AuthenticateUserWithCode with a used recovery code = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestDisableTOTPDoesNotSignIn(t *testing.T) {
+	s := newTestStore(t)
+	s.EnableEncryption()
+	createUser(t, s, "alice")
+	s.Lock("alice")
+	_, codes := enableTOTP(t, s, "alice")
+
+	if err := s.DisableTOTP("alice", "password", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if enabled, err := s.TOTPEnabled("alice"); err != nil || enabled {
+		t.Errorf("TOTPEnabled = %v, %v after DisableTOTP", enabled, err)
+	}
+	if s.dataKey("alice") != nil || s.holds["alice"] != 0 {
+		t.Error("DisableTOTP left alice signed in")
+	}
+}
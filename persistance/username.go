@@ -0,0 +1,165 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Usernames are stored in a canonical form, see NormalizeUsername.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+)
+
+// usernameSeparators may appear inside a username, between letters and
+// digits.
+const usernameSeparators = "._-"
+
+// ErrInvalidUsername is returned, wrapped with the rule broken, for a
+// username that does not follow the rules of NormalizeUsername.
+var ErrInvalidUsername = errors.New("invalid username")
+
+// ErrUsernameConfusable is returned by CreateUser for a username that looks
+// like an existing one, e.g. "jane.doe" next to "janedoe", or a Cyrillic "а"
+// in place of a Latin "a".
+var ErrUsernameConfusable = errors.New("username is too similar to an existing one")
+
+// NormalizeUsername returns the canonical form of name: NFKC normalized and
+// case folded, so that "Alice" and "ａｌｉｃｅ" are both "alice". Usernames
+// have MinUsernameLength to MaxUsernameLength letters, digits and
+// separators (".", "_" and "-"), and start with a letter or a digit.
+func NormalizeUsername(name string) (string, error) {
+	canonical := fold(name)
+	if n := len([]rune(canonical)); n < MinUsernameLength || n > MaxUsernameLength {
+		return "", fmt.Errorf("%w: must be %d to %d characters", ErrInvalidUsername, MinUsernameLength, MaxUsernameLength)
+	}
+	for i, r := range canonical {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case i > 0 && unicode.IsMark(r): // accents that have no precomposed letter
+		case i > 0 && strings.ContainsRune(usernameSeparators, r):
+		case unicode.IsSpace(r):
+			return "", fmt.Errorf("%w: cannot contain spaces", ErrInvalidUsername)
+		case i == 0 && strings.ContainsRune(usernameSeparators, r):
+			return "", fmt.Errorf("%w: must start with a letter or a digit", ErrInvalidUsername)
+		default:
+			return "", fmt.Errorf("%w: cannot contain %q", ErrInvalidUsername, r)
+		}
+	}
+	return canonical, nil
+}
+
+func fold(name string) string {
+	// Folding can leave a string that is no longer normalized.
+	s := norm.NFKC.String(strings.TrimSpace(name))
+	return norm.NFKC.String(cases.Fold().String(s))
+}
+
+// confusables maps characters to the Latin letter or digit they are
+// commonly mistaken for, after case folding. It covers the look-alikes of
+// the Unicode confusables list (UTS #39) that usernames can contain.
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'ı': 'i',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q',
+	'ѕ': 's', 'т': 't', 'с': 'c', 'у': 'y', 'ԝ': 'w', 'х': 'x',
+	// Greek
+	'α': 'a', 'β': 'b', 'ϲ': 'c', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+}
+
+// skeletonSequences replaces letter pairs that read as a single letter.
+var skeletonSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// skeleton maps name to a form shared by the names it can be mistaken for:
+// without separators or accents, and with look-alike characters replaced.
+func skeleton(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(fold(name)) {
+		if unicode.Is(unicode.Mn, r) || strings.ContainsRune(usernameSeparators, r) {
+			continue
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return skeletonSequences.Replace(b.String())
+}
+
+// confusableUser returns an existing user other than except whose name has
+// the same skeleton as username, or "" if there is none.
+func confusableUser(txn *badger.Txn, username, except string) string {
+	skel := skeleton(username)
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte("user:")
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		name := strings.TrimPrefix(string(it.Item().Key()), "user:")
+		if name != except && skeleton(name) == skel {
+			return name
+		}
+	}
+	return ""
+}
+
+// resolveUsername returns the stored name of the user signing in as name:
+// its canonical form, or name itself for an account created before
+// usernames were normalized that could not be renamed.
+func (s *Store) resolveUsername(name string) (string, error) {
+	canonical, err := NormalizeUsername(name)
+	if err == nil {
+		return canonical, nil
+	}
+	err = s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(userKey(name))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed retrieving user: %w", err)
+	}
+	return name, nil
+}
+
+// canonicalizeUsernames renames the users created before usernames were
+// normalized (version 2 to 3). Names without a valid canonical form, or
+// whose canonical form is taken, are kept as they are.
+func canonicalizeUsernames(txn *badger.Txn) error {
+	var names []string
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte("user:")
+	it := txn.NewIterator(opts)
+	for it.Rewind(); it.Valid(); it.Next() {
+		names = append(names, strings.TrimPrefix(string(it.Item().Key()), "user:"))
+	}
+	it.Close()
+
+	taken := map[string]bool{}
+	for _, name := range names {
+		taken[name] = true
+	}
+	for _, name := range names {
+		canonical, err := NormalizeUsername(name)
+		if err != nil || canonical == name || taken[canonical] {
+			continue
+		}
+		if err := renameUser(txn, name, canonical); err != nil {
+			return fmt.Errorf("failed renaming %s: %w", name, err)
+		}
+		taken[canonical] = true
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+// ErrStoreClosed is returned by WaitBoard when the store is closed while
+// waiting.
+var ErrStoreClosed = errors.New("store closed")
+
+// errChanged ends the subscription of WaitBoard at the first change.
+var errChanged = errors.New("board changed")
+
+// WaitBoard blocks until the tasks on the board of owner are saved, by
+// anyone using this store, and returns nil. It returns the error of ctx if
+// it is done first. Saves made while nobody is waiting are not reported, so
+// callers compare the board with what they have when they wait again.
+func (s *Store) WaitBoard(ctx context.Context, owner string) error {
+	prefix := []byte("tasks:" + owner + ":")
+	err := s.db.Subscribe(ctx, func(kvs *pb.KVList) error {
+		for _, kv := range kvs.Kv {
+			if ownKey(kv.Key, prefix, 1) {
+				return errChanged
+			}
+		}
+		return nil
+	}, []pb.Match{{Prefix: prefix}})
+	switch {
+	case errors.Is(err, errChanged):
+		return nil
+	case err == nil:
+		return ErrStoreClosed
+	}
+	return err
+}
@@ -0,0 +1,11 @@
+package main
+
+import "os"
+
+// notifyResize does nothing: Windows has no signal for the size of the
+// console changing, so attached boards keep the size they started with.
+func notifyResize(c chan<- os.Signal) {}
+
+func stopResize(c chan os.Signal) {
+	close(c)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	bm "github.com/charmbracelet/wish/bubbletea"
+	"github.com/charmbracelet/wish/logging"
+	"github.com/muesli/termenv"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// hostKeyFileName is the file, inside the application directory, holding
+// the host key of the SSH server. It is created on first use.
+const hostKeyFileName = "ssh_host_ed25519"
+
+// shutdownTimeout is how long the server waits for connections to end
+// after it is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// remoteConn is shared by the copies of the model of one SSH connection or
+// attached process, so that the server can lock the tasks of a user still
+// signed in when the connection ends.
+type remoteConn struct {
+	client string // the username the SSH client connected as
+
+	mu       sync.Mutex
+	username string // signed in, or ""
+}
+
+// setUser records who is signed in on the connection. It does nothing for
+// a model that is not served over a connection.
+func (c *remoteConn) setUser(username string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username = username
+}
+
+func (c *remoteConn) user() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username
+}
+
+// authenticateKeyCmd creates a tea.Cmd that signs in the user an SSH client
+// connected as with the public key it authenticated with.
+func authenticateKeyCmd(store persistence.Backend, username string, key ssh.PublicKey) tea.Cmd {
+	return func() tea.Msg {
+		uname, err := store.AuthenticateKey(username, key)
+		if err != nil {
+			return authErrMsg{fmt.Errorf("could not sign in as %s with your key: %w", username, err)}
+		}
+		return authSuccessMsg{username: uname}
+	}
+}
+
+// server is what runServe needs of the SSH and HTTP servers.
+type server interface {
+	ListenAndServe() error
+	Shutdown(ctx context.Context) error
+}
+
+// runServe serves the board to remote terminals, the HTTP API, or both,
+// until interrupted.
+func runServe(a *app, args []string) error {
+	fs := newFlagSet("serve")
+	serveSSH := fs.Bool("ssh", false, "serve the board over SSH")
+	sshAddr := fs.String("ssh-addr", "localhost:23234", "address the SSH server listens on")
+	hostKey := fs.String("host-key", filepath.Join(a.baseDir, hostKeyFileName), "host key of the SSH server, created if missing")
+	serveHTTP := fs.Bool("http", false, "serve the JSON API over HTTP")
+	httpAddr := fs.String("http-addr", "localhost:23235", "address the HTTP server listens on")
+	origin := fs.String("http-origin", "", "origin of a web page allowed to call the API, e.g. http://localhost:3000")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if !*serveSSH && !*serveHTTP {
+		fs.Usage()
+		return errors.New("nothing to serve; use -ssh, -http or both")
+	}
+
+	var servers []server
+	if *serveSSH {
+		srv, err := newSSHServer(a.store, *sshAddr, *hostKey)
+		if err != nil {
+			return err
+		}
+		if !isLocalAddr(*sshAddr) {
+			log.Printf("Warning: %s accepts connections from other machines; anyone who can reach it can sign up", *sshAddr)
+		}
+		log.Printf("Serving over SSH on %s", *sshAddr)
+		servers = append(servers, srv)
+	}
+	if *serveHTTP {
+		api := &apiServer{store: a.store, ttl: a.cfg.Security.SessionTTL, origin: *origin}
+		if !isLocalAddr(*httpAddr) {
+			log.Printf("Warning: %s accepts connections from other machines and does not use TLS; put it behind a proxy that does", *httpAddr)
+		}
+		log.Printf("Serving the API over HTTP on %s", *httpAddr)
+		servers = append(servers, &http.Server{
+			Addr:              *httpAddr,
+			Handler:           api.handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+
+	if a.store.ReadOnly() {
+		log.Printf("The database is open read-only")
+	}
+	if ownsDatabase(a.store) {
+		if inst, err := listenInstance(a.store, a.baseDir, a.cfg.Security.SessionTTL); err != nil {
+			log.Printf("Warning: other terminals cannot attach: %v", err)
+		} else {
+			defer inst.Close()
+		}
+	}
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			errs <- srv.ListenAndServe()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errs:
+		if isServerClosed(err) {
+			err = nil
+		}
+	case <-done:
+		log.Printf("Stopping")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if serr := srv.Shutdown(ctx); serr != nil && !isServerClosed(serr) && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func isServerClosed(err error) bool {
+	return errors.Is(err, ssh.ErrServerClosed) || errors.Is(err, http.ErrServerClosed)
+}
+
+// newSSHServer returns an SSH server running the application for each
+// connection. Clients signing in with a public key authorized for the user
+// they connect as go straight to their board; everybody else gets the sign
+// in menu, as in a local terminal.
+func newSSHServer(store persistence.Backend, addr, hostKey string) (*ssh.Server, error) {
+	// The styles are rendered for the clients, not the terminal of the server
+	lipgloss.SetColorProfile(termenv.ANSI256)
+
+	return wish.NewServer(
+		wish.WithAddress(addr),
+		wish.WithHostKeyPath(hostKey),
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			_, err := store.KeyAuthorized(ctx.User(), key)
+			return err == nil
+		}),
+		// Without an authorized key the application asks for the password
+		wish.WithKeyboardInteractiveAuth(func(ssh.Context, gossh.KeyboardInteractiveChallenge) bool {
+			return true
+		}),
+		wish.WithMiddleware(
+			lockOnDisconnect(store),
+			bm.MiddlewareWithColorProfile(func(sess ssh.Session) (tea.Model, []tea.ProgramOption) {
+				return remoteModel(store, sess), []tea.ProgramOption{tea.WithAltScreen()}
+			}, termenv.ANSI256),
+			activeterm.Middleware(),
+			logging.Middleware(),
+		),
+	)
+}
+
+// connKey is the context key of the remoteConn of a session.
+type connKey struct{}
+
+// remoteModel returns the model of a new SSH session.
+func remoteModel(store persistence.Backend, sess ssh.Session) tea.Model {
+	conn := &remoteConn{client: sess.User()}
+	sess.Context().SetValue(connKey{}, conn)
+	// Sessions are not remembered: the session file is on the server
+	m := initialModel(store, "", 0)
+	m.conn = conn
+	if key := sess.PublicKey(); key != nil {
+		m.publicKey = key
+		m.state = submitting
+		m.opInProgress = "key"
+	}
+	return m
+}
+
+// lockOnDisconnect locks the tasks of the user still signed in when an SSH
+// session ends, as logging out would.
+func lockOnDisconnect(store persistence.Backend) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(sess ssh.Session) {
+			next(sess)
+			conn, ok := sess.Context().Value(connKey{}).(*remoteConn)
+			if !ok {
+				return
+			}
+			if username := conn.user(); username != "" {
+				store.Lock(username)
+			}
+		}
+	}
+}
+
+// isLocalAddr reports whether addr only accepts connections from this
+// machine.
+func isLocalAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
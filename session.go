@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sessionFileName is the file, inside the application directory, holding
+// the token of the remembered session.
+const sessionFileName = "session"
+
+type sessionInvalidMsg struct{ err error }
+
+func sessionPath(baseDir string) string {
+	return filepath.Join(baseDir, sessionFileName)
+}
+
+// readSessionToken returns the remembered session token, or "" if there is
+// none.
+func readSessionToken(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeSessionToken remembers token in a file only the user can read.
+func writeSessionToken(path, token string) error {
+	// Remove any previous file so it is created with the right permissions.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.WriteFile(path, []byte(token+"\n"), 0600)
+}
+
+// forgetSession revokes the remembered session and removes its file.
+func forgetSession(store persistence.Backend, path, token string) {
+	if token == "" {
+		return
+	}
+	store.EndSession(token)
+	os.Remove(path)
+}
+
+// resumeSessionCmd creates a tea.Cmd that signs in with the remembered session.
+func resumeSessionCmd(store persistence.Backend, path, token string) tea.Cmd {
+	return func() tea.Msg {
+		username, err := store.ResumeSession(token)
+		if err != nil {
+			os.Remove(path)
+			return sessionInvalidMsg{err}
+		}
+		return authSuccessMsg{username: username, session: token}
+	}
+}
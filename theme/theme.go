@@ -0,0 +1,244 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ReggieReo/todo-elm/config"
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Names of the built-in themes.
+const (
+	Auto         = "auto"
+	Dark         = "dark"
+	Light        = "light"
+	HighContrast = "high-contrast"
+	NoColor      = "no-color"
+)
+
+// Theme holds the colors and borders used by every view.
+type Theme struct {
+	Name    string
+	Accent  lipgloss.TerminalColor // focused borders, selected items and titles
+	Text    lipgloss.TerminalColor // text drawn on top of the accent color
+	Muted   lipgloss.TerminalColor // descriptions, placeholders and help
+	Spinner lipgloss.TerminalColor
+	Error   lipgloss.TerminalColor
+	Border  lipgloss.Border // border of the focused column
+}
+
+var builtins = []Theme{
+	{
+		Name:    Dark,
+		Accent:  lipgloss.Color("62"),
+		Text:    lipgloss.Color("230"),
+		Muted:   lipgloss.Color("241"),
+		Spinner: lipgloss.Color("205"),
+		Error:   lipgloss.Color("9"),
+		Border:  lipgloss.RoundedBorder(),
+	},
+	{
+		Name:    Light,
+		Accent:  lipgloss.Color("27"),
+		Text:    lipgloss.Color("255"),
+		Muted:   lipgloss.Color("245"),
+		Spinner: lipgloss.Color("161"),
+		Error:   lipgloss.Color("160"),
+		Border:  lipgloss.RoundedBorder(),
+	},
+	{
+		Name:    HighContrast,
+		Accent:  lipgloss.Color("11"),
+		Text:    lipgloss.Color("0"),
+		Muted:   lipgloss.Color("15"),
+		Spinner: lipgloss.Color("11"),
+		Error:   lipgloss.Color("9"),
+		Border:  lipgloss.ThickBorder(),
+	},
+	{
+		Name:    NoColor,
+		Accent:  lipgloss.NoColor{},
+		Text:    lipgloss.NoColor{},
+		Muted:   lipgloss.NoColor{},
+		Spinner: lipgloss.NoColor{},
+		Error:   lipgloss.NoColor{},
+		Border:  lipgloss.NormalBorder(),
+	},
+}
+
+var borders = map[string]lipgloss.Border{
+	"rounded": lipgloss.RoundedBorder(),
+	"normal":  lipgloss.NormalBorder(),
+	"thick":   lipgloss.ThickBorder(),
+	"double":  lipgloss.DoubleBorder(),
+	"block":   lipgloss.BlockBorder(),
+	"hidden":  lipgloss.HiddenBorder(),
+}
+
+var (
+	mu        sync.RWMutex
+	current   = builtins[0]
+	overrides config.Theme
+)
+
+// Names returns the names accepted by Configure and Set, in cycling order.
+func Names() []string {
+	names := []string{Auto}
+	for _, t := range builtins {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// Detect picks the theme matching the terminal: no-color when NO_COLOR is
+// set, otherwise dark or light depending on the background.
+func Detect() string {
+	if os.Getenv("NO_COLOR") != "" {
+		return NoColor
+	}
+	if lipgloss.HasDarkBackground() {
+		return Dark
+	}
+	return Light
+}
+
+// Configure selects the theme named in cfg and keeps its color overrides for
+// every theme selected later. Overrides are ignored by the no-color theme.
+func Configure(cfg config.Theme) error {
+	mu.Lock()
+	overrides = cfg
+	mu.Unlock()
+	return Set(cfg.Name)
+}
+
+// Set makes the named theme current. "auto" and "" run Detect.
+func Set(name string) error {
+	if name == "" || name == Auto {
+		name = Detect()
+	}
+	for _, t := range builtins {
+		if t.Name == name {
+			mu.Lock()
+			current = t.withOverrides(overrides)
+			mu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown theme %q (want one of %s)", name, strings.Join(Names(), ", "))
+}
+
+// Cycle switches to the next built-in theme and returns it.
+func Cycle() Theme {
+	name := Current().Name
+	next := builtins[0].Name
+	for i, t := range builtins {
+		if t.Name == name {
+			next = builtins[(i+1)%len(builtins)].Name
+		}
+	}
+	_ = Set(next)
+	return Current()
+}
+
+// Current returns the theme in use.
+func Current() Theme {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+func (t Theme) withOverrides(o config.Theme) Theme {
+	if t.Name == NoColor {
+		return t
+	}
+	if o.Accent != "" {
+		t.Accent = lipgloss.Color(o.Accent)
+	}
+	if o.Spinner != "" {
+		t.Spinner = lipgloss.Color(o.Spinner)
+	}
+	if o.Error != "" {
+		t.Error = lipgloss.Color(o.Error)
+	}
+	if b, ok := borders[o.Border]; ok {
+		t.Border = b
+	}
+	return t
+}
+
+// ErrorStyle renders error messages.
+func (t Theme) ErrorStyle() lipgloss.Style {
+	s := lipgloss.NewStyle().Foreground(t.Error)
+	if t.Name == NoColor {
+		s = s.Bold(true)
+	}
+	return s
+}
+
+// SpinnerStyle renders the spinner.
+func (t Theme) SpinnerStyle() lipgloss.Style {
+	return lipgloss.NewStyle().Foreground(t.Spinner)
+}
+
+// MutedStyle renders secondary text.
+func (t Theme) MutedStyle() lipgloss.Style {
+	s := lipgloss.NewStyle().Foreground(t.Muted)
+	if t.Name == NoColor {
+		s = s.Faint(true)
+	}
+	return s
+}
+
+// TitleStyle renders titles drawn on the accent color.
+func (t Theme) TitleStyle() lipgloss.Style {
+	s := lipgloss.NewStyle().Padding(0, 1)
+	if t.Name == NoColor {
+		return s.Reverse(true)
+	}
+	return s.Foreground(t.Text).Background(t.Accent)
+}
+
+// Huh returns the matching theme for huh forms.
+func (t Theme) Huh() *huh.Theme {
+	if t.Name == NoColor {
+		h := huh.ThemeBase()
+		h.Focused.Title = h.Focused.Title.Bold(true)
+		h.Focused.SelectSelector = h.Focused.SelectSelector.Bold(true)
+		h.Focused.FocusedButton = h.Focused.FocusedButton.UnsetForeground().UnsetBackground().Reverse(true)
+		h.Focused.BlurredButton = h.Focused.BlurredButton.UnsetForeground().UnsetBackground()
+		h.Focused.TextInput.Placeholder = h.Focused.TextInput.Placeholder.UnsetForeground().Faint(true)
+		h.Blurred = h.Focused
+		h.Blurred.Base = h.Focused.Base.BorderStyle(lipgloss.HiddenBorder())
+		h.Blurred.Card = h.Blurred.Base
+		return h
+	}
+
+	h := huh.ThemeCharm()
+	h.Focused.Base = h.Focused.Base.BorderForeground(t.Accent)
+	h.Focused.Card = h.Focused.Base
+	h.Focused.Title = h.Focused.Title.Foreground(t.Accent)
+	h.Focused.NoteTitle = h.Focused.NoteTitle.Foreground(t.Accent)
+	h.Focused.Description = h.Focused.Description.Foreground(t.Muted)
+	h.Focused.ErrorIndicator = h.Focused.ErrorIndicator.Foreground(t.Error)
+	h.Focused.ErrorMessage = h.Focused.ErrorMessage.Foreground(t.Error)
+	h.Focused.SelectSelector = h.Focused.SelectSelector.Foreground(t.Accent)
+	h.Focused.NextIndicator = h.Focused.NextIndicator.Foreground(t.Accent)
+	h.Focused.PrevIndicator = h.Focused.PrevIndicator.Foreground(t.Accent)
+	h.Focused.MultiSelectSelector = h.Focused.MultiSelectSelector.Foreground(t.Accent)
+	h.Focused.FocusedButton = h.Focused.FocusedButton.Foreground(t.Text).Background(t.Accent)
+	h.Focused.Next = h.Focused.FocusedButton
+	h.Focused.TextInput.Prompt = h.Focused.TextInput.Prompt.Foreground(t.Accent)
+	h.Focused.TextInput.Placeholder = h.Focused.TextInput.Placeholder.Foreground(t.Muted)
+	h.Blurred = h.Focused
+	h.Blurred.Base = h.Focused.Base.BorderStyle(lipgloss.HiddenBorder())
+	h.Blurred.Card = h.Blurred.Base
+	h.Blurred.NextIndicator = lipgloss.NewStyle()
+	h.Blurred.PrevIndicator = lipgloss.NewStyle()
+	h.Group.Title = h.Focused.Title
+	h.Group.Description = h.Focused.Description
+	return h
+}
@@ -0,0 +1,119 @@
+package todolist
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ReggieReo/todo-elm/theme"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// assignedView lists the tasks assigned to the user on every board they can
+// open. It only shows them; the tasks are changed on their board.
+type assignedView struct {
+	board  *Board // returned to when the view is closed
+	help   help.Model
+	list   list.Model
+	status string // boards that could not be read
+}
+
+// assignedItem is a task in the assigned view, with the board it is on.
+type assignedItem struct {
+	Task
+	owner string
+	self  bool // the board is the user's own
+}
+
+func (i assignedItem) FilterValue() string {
+	return i.title
+}
+
+// Title leaves out the initials, as every task is assigned to the user.
+func (i assignedItem) Title() string {
+	if i.stored.Priority != "" {
+		return "(" + i.stored.Priority + ") " + i.title
+	}
+	return i.title
+}
+
+// Description shows the board and column before the due date and tags.
+func (i assignedItem) Description() string {
+	where := fmt.Sprintf("%s's board · %s", i.owner, columnTitles[i.status])
+	if i.self {
+		where = "Your board · " + columnTitles[i.status]
+	}
+	if desc := i.Task.Description(); desc != "" {
+		return where + " · " + desc
+	}
+	return where
+}
+
+// newAssignedView opens the tasks assigned to the user of b, returning to b
+// when it is closed.
+func newAssignedView(b *Board) (tea.Model, tea.Cmd) {
+	tasks, err := b.store.AssignedTasks(b.username)
+	v := &assignedView{board: b, help: b.help}
+	if err != nil {
+		log.Printf("Error listing assigned tasks: %v", err)
+		v.status = fmt.Sprintf("Some boards could not be read: %v", err)
+	}
+	items := make([]list.Item, len(tasks))
+	for i, t := range tasks {
+		items[i] = assignedItem{Task: taskFromStored(t.Task), owner: t.Owner, self: t.Owner == b.username}
+	}
+	d := list.NewDefaultDelegate()
+	t := theme.Current()
+	if t.Name != theme.NoColor {
+		d.Styles.NormalDesc = d.Styles.NormalDesc.Foreground(t.Muted)
+		d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(t.Accent).BorderForeground(t.Accent)
+		d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(t.Accent).BorderForeground(t.Accent)
+	}
+	v.list = list.New(items, d, b.width-margin, b.height-margin)
+	v.list.Title = "Assigned to you"
+	v.list.Styles.Title = t.TitleStyle()
+	v.list.SetShowHelp(false)
+	v.list.KeyMap = listKeyMap()
+	v.list.SetStatusBarItemName("task", "tasks")
+	return v, nil
+}
+
+func (v *assignedView) Init() tea.Cmd {
+	return nil
+}
+
+func (v *assignedView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		v.board.Update(msg)
+		v.list.SetSize(msg.Width-margin, msg.Height-margin)
+		return v, nil
+	case RefreshMsg:
+		_, cmd := v.board.Update(msg)
+		return v, cmd
+	case tea.KeyMsg:
+		if v.list.FilterState() == list.Filtering {
+			break
+		}
+		switch {
+		case key.Matches(msg, keys.Quit):
+			return v, tea.Quit
+		case key.Matches(msg, keys.Back, keys.MyTasks):
+			return v.board.Update(nil)
+		}
+	}
+	var cmd tea.Cmd
+	v.list, cmd = v.list.Update(msg)
+	return v, cmd
+}
+
+func (v *assignedView) View() string {
+	view := v.list.View()
+	if v.status != "" {
+		view = lipgloss.JoinVertical(lipgloss.Left, view, theme.Current().MutedStyle().Render(v.status))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, view, v.help.ShortHelpView([]key.Binding{keys.Back, keys.Quit}))
+}
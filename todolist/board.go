@@ -1,9 +1,16 @@
 package todolist
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"time"
 
 	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"github.com/ReggieReo/todo-elm/theme"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,26 +24,94 @@ type Board struct {
 	cols     []column
 	quitting bool
 	username string
-	store    *persistence.Store
+	owner    string           // whose board it is; username unless shared
+	role     persistence.Role // of username on the board
+	readOnly bool             // viewers, and boards that failed to load
+	members  []string         // who tasks can be assigned to, owner first
+	mine     bool             // only the tasks assigned to username are shown
+	width    int
+	height   int
+	store    persistence.Backend
+	status   string // one-line result of the last action, e.g. an export
+	// saved holds the tasks as last loaded or saved, with the revision the
+	// next save is made to. Its columns are nil if the board failed to load.
+	saved persistence.BoardTasks
+	// conflict holds the board as saved elsewhere when a save conflicted
+	// with it, until the user merges or reloads, see resolveConflict.
+	conflict *persistence.BoardTasks
 }
 
-var board *Board
+// conflictKeys answer the prompt shown when a save conflicts.
+var conflictKeys = struct {
+	Merge  key.Binding
+	Reload key.Binding
+}{
+	Merge: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "merge, keeping your version of tasks changed on both sides"),
+	),
+	Reload: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "reload, discarding your change"),
+	),
+}
+
+// refreshInterval is how often an open board checks for changes it was not
+// told about, e.g. while it was not waiting for them.
+const refreshInterval = time.Minute
+
+// RefreshMsg tells a board that its tasks may have been changed elsewhere,
+// e.g. from another terminal connected to the same server. Models shown over
+// the board pass it on, so that the board keeps watching.
+type RefreshMsg struct {
+	board *Board
+}
+
+// NewBoard opens the board of username.
+func NewBoard(username string, store persistence.Backend) *Board {
+	return OpenBoard(username, persistence.BoardRef{Owner: username, Role: persistence.RoleOwner}, store)
+}
 
-func NewBoard(username string, store *persistence.Store) *Board {
+// OpenBoard opens a board username can access: their own or one shared with
+// them. Changes are refused unless their role allows them.
+func OpenBoard(username string, ref persistence.BoardRef, store persistence.Backend) *Board {
 	help := help.New()
 	help.ShowAll = true
-	board = &Board{
+	board := &Board{
 		help:     help,
-		focused:  todo,
+		focused:  defaultFocus,
 		username: username,
+		owner:    ref.Owner,
+		role:     ref.Role,
+		readOnly: !ref.Role.CanWrite() || store.ReadOnly(),
 		store:    store,
 	}
+	members, err := store.BoardMembers(ref.Owner)
+	if err != nil {
+		log.Printf("Error listing board members: %v", err)
+		members = []string{ref.Owner}
+	}
+	board.members = members
+	board.syncTodoTxt()
 	board.initLists()
+	board.applyTheme(theme.Current())
 	return board
 }
 
+// applyTheme restyles the columns and help with t.
+func (m *Board) applyTheme(t theme.Theme) {
+	for i := range m.cols {
+		m.cols[i].applyTheme(t)
+	}
+	m.help.Styles.ShortKey = m.help.Styles.ShortKey.Foreground(t.Muted)
+	m.help.Styles.FullKey = m.help.Styles.FullKey.Foreground(t.Muted)
+	m.help.Styles.ShortDesc = t.MutedStyle().Faint(true)
+	m.help.Styles.FullDesc = t.MutedStyle().Faint(true)
+}
+
+// Init starts watching the board for changes made elsewhere.
 func (m *Board) Init() tea.Cmd {
-	return nil
+	return m.watch()
 }
 
 func (m *Board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -45,6 +120,7 @@ func (m *Board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		var cmd tea.Cmd
 		var cmds []tea.Cmd
 		m.help.Width = msg.Width - margin
+		m.width, m.height = msg.Width, msg.Height
 		for i := 0; i < len(m.cols); i++ {
 			var res tea.Model
 			res, cmd = m.cols[i].Update(msg)
@@ -53,19 +129,59 @@ func (m *Board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.loaded = true
 		return m, tea.Batch(cmds...)
+	case RefreshMsg:
+		if msg.board != m {
+			// Sent to a board that has been closed since
+			return m, nil
+		}
+		if m.conflict == nil {
+			m.refresh()
+		}
+		return m, m.watch()
 	case *Form:
-		cmd := m.cols[m.focused].Set(msg.index, msg.CreateTask())
+		task := msg.CreateTask()
+		if m.mine && msg.index == APPEND {
+			// Otherwise the new task would be hidden by the filter.
+			task.stored.Assignee = m.username
+		}
+		col, index := m.focused, msg.index
+		if index != APPEND {
+			// The board may have been reloaded while the task was edited
+			col, index = m.locate(task.stored.ID)
+			if index < 0 {
+				col, index = m.focused, APPEND
+				m.status = "The task was deleted elsewhere; it was added again."
+			} else {
+				edited := task
+				task = m.cols[col].list.Items()[index].(Task)
+				task.title, task.description = edited.title, edited.description
+			}
+		}
+		cmd := m.cols[col].Set(index, task)
 		if err := m.saveTasks(); err != nil {
 			log.Printf("Error saving tasks: %v", err)
 		}
+		m.applyFilter()
 		return m, cmd
 	case moveMsg:
 		cmd := m.cols[m.focused.getNext()].Set(APPEND, msg.Task)
 		if err := m.saveTasks(); err != nil {
 			log.Printf("Error saving tasks: %v", err)
 		}
+		m.applyFilter()
 		return m, cmd
 	case tea.KeyMsg:
+		if m.conflict != nil {
+			return m.resolveConflict(msg)
+		}
+		m.status = ""
+		if m.readOnly && key.Matches(msg, keys.New, keys.Edit, keys.Delete, keys.Enter, keys.Assign, keys.Account) {
+			m.status = "This board is read-only."
+			if m.store.ReadOnly() {
+				m.status = "The database is open read-only."
+			}
+			return m, nil
+		}
 		switch {
 		case key.Matches(msg, keys.Quit):
 			if err := m.saveTasks(); err != nil {
@@ -84,15 +200,39 @@ func (m *Board) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, keys.Help):
 			m.help.ShowAll = !m.help.ShowAll
 			return m, nil
+		case key.Matches(msg, keys.Theme):
+			m.applyTheme(theme.Cycle())
+			return m, nil
+		case key.Matches(msg, keys.Export):
+			m.status = m.export()
+			return m, nil
+		case key.Matches(msg, keys.Assign):
+			m.status = m.assignSelected()
+			return m, nil
+		case key.Matches(msg, keys.Mine):
+			m.mine = !m.mine
+			m.applyFilter()
+			m.status = "Showing all tasks."
+			if m.mine {
+				m.status = "Showing the tasks assigned to you."
+			}
+			return m, nil
+		case key.Matches(msg, keys.MyTasks):
+			return newAssignedView(m)
 		}
 	}
 	res, cmd := m.cols[m.focused].Update(msg)
+	if f, ok := res.(*Form); ok {
+		// The form returns to this board once it is done
+		f.board = m
+	}
 	if _, ok := res.(column); ok {
 		m.cols[m.focused] = res.(column)
 		if deleteMsg, ok := msg.(deleteMsg); ok && deleteMsg.status == m.focused {
 			if err := m.saveTasks(); err != nil {
 				log.Printf("Error saving tasks after deletion: %v", err)
 			}
+			m.applyFilter()
 		}
 	} else {
 		return res, cmd
@@ -114,5 +254,169 @@ func (m *Board) View() string {
 		m.cols[inProgress].View(),
 		m.cols[done].View(),
 	)
+	if m.owner != m.username {
+		header := fmt.Sprintf("%s's board (%s)", m.owner, m.role)
+		boardView = lipgloss.JoinVertical(lipgloss.Left, theme.Current().MutedStyle().Render(header), boardView)
+	}
+	if notice := ReadOnlyNotice(m.store); notice != "" {
+		boardView = lipgloss.JoinVertical(lipgloss.Left, notice, boardView)
+	}
+	if m.conflict != nil {
+		prompt := theme.Current().ErrorStyle().Render("The board was changed elsewhere since your last change.")
+		return lipgloss.JoinVertical(lipgloss.Left, boardView, prompt,
+			m.help.FullHelpView([][]key.Binding{{conflictKeys.Merge, conflictKeys.Reload}}))
+	}
+	if m.status != "" {
+		boardView = lipgloss.JoinVertical(lipgloss.Left, boardView, theme.Current().MutedStyle().Render(m.status))
+	}
 	return lipgloss.JoinVertical(lipgloss.Left, boardView, m.help.View(keys))
 }
+
+// ReadOnlyNotice returns the indicator shown while store is read-only, or
+// "" if it is not.
+func ReadOnlyNotice(store persistence.Backend) string {
+	if !store.ReadOnly() {
+		return ""
+	}
+	notice := "READ ONLY"
+	if taken, ok := store.Snapshot(); ok {
+		notice += fmt.Sprintf(": a copy of the database made at %s, as another todo-elm has it open", taken.Format("15:04"))
+	}
+	return theme.Current().ErrorStyle().Render(notice)
+}
+
+// assignSelected assigns the selected task to the next member of the board,
+// after the last one unassigning it, and returns the status to show.
+func (m *Board) assignSelected() string {
+	c := &m.cols[m.focused]
+	task, ok := c.list.SelectedItem().(Task)
+	if !ok {
+		return ""
+	}
+	next := ""
+	if i := slices.Index(m.members, task.stored.Assignee); i+1 < len(m.members) {
+		next = m.members[i+1]
+	}
+	task.stored.Assignee = next
+	c.Set(c.list.GlobalIndex(), task)
+	if err := m.saveTasks(); err != nil {
+		log.Printf("Error saving tasks: %v", err)
+	}
+	m.applyFilter()
+	if next == "" {
+		return "Unassigned."
+	}
+	return fmt.Sprintf("Assigned to %s.", next)
+}
+
+// applyFilter shows only the tasks assigned to the user in every column
+// while mine is set, and all of them again once it is cleared.
+func (m *Board) applyFilter() {
+	for i := range m.cols {
+		l := &m.cols[i].list
+		switch {
+		case m.mine:
+			l.SetFilterText(assignedFilter + m.username)
+		case strings.HasPrefix(l.FilterValue(), assignedFilter):
+			l.ResetFilter()
+		}
+	}
+}
+
+// watch returns a command waiting for the tasks of the board to be saved
+// elsewhere, or for refreshInterval to pass.
+func (m *Board) watch() tea.Cmd {
+	store, owner := m.store, m.owner
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshInterval)
+		defer cancel()
+		err := store.WaitBoard(ctx, owner)
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			if !errors.Is(err, persistence.ErrStoreClosed) {
+				log.Printf("Error watching the board: %v", err)
+			}
+			return nil
+		}
+		return RefreshMsg{board: m}
+	}
+}
+
+// refresh reloads the tasks if they were saved elsewhere. Saves of the
+// board itself are seen too, and ignored as the revision is the one saved.
+func (m *Board) refresh() {
+	if m.saved.Columns == nil {
+		return
+	}
+	board, err := m.store.LoadBoard(m.username, m.owner)
+	if err != nil || board.Revision == m.saved.Revision {
+		return
+	}
+	m.showColumns(board.Columns)
+	m.saved = board
+	m.status = "Updated with changes made elsewhere."
+}
+
+// showColumns shows the tasks of every column in place of the current ones.
+func (m *Board) showColumns(columns [][]persistence.Task) {
+	for i := range m.cols {
+		m.cols[i].setTasks(columns[i])
+	}
+	m.applyFilter()
+}
+
+// resolveConflict answers the prompt shown after a save conflicted with
+// changes saved elsewhere: the changes are merged and saved again, or the
+// board is reloaded. Other keys are ignored until then, but quitting, which
+// leaves the board as saved elsewhere.
+func (m *Board) resolveConflict(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	theirs := *m.conflict
+	switch {
+	case key.Matches(msg, keys.Quit):
+		m.quitting = true
+		return m, tea.Quit
+	case key.Matches(msg, conflictKeys.Reload):
+		m.conflict = nil
+		m.showColumns(theirs.Columns)
+		m.saved = theirs
+		m.status = "Reloaded the board; your change was discarded."
+	case key.Matches(msg, conflictKeys.Merge):
+		m.conflict = nil
+		merged, both := mergeColumns(m.saved.Columns, m.columns(), theirs.Columns)
+		m.showColumns(merged)
+		m.saved = theirs
+		if err := m.saveTasks(); err != nil {
+			// Changed again in the meantime: asked again
+			log.Printf("Error saving tasks: %v", err)
+			return m, nil
+		}
+		m.status = "Merged your change with the ones made elsewhere."
+		switch {
+		case both == 1:
+			m.status = "Merged your change with the ones made elsewhere; kept yours for a task changed on both sides."
+		case both > 1:
+			m.status = fmt.Sprintf("Merged your change with the ones made elsewhere; kept yours for %d tasks changed on both sides.", both)
+		}
+	}
+	return m, nil
+}
+
+// locate returns the column and index of the task with the given ID, or an
+// index of -1 if it is on none.
+func (m *Board) locate(id string) (status, int) {
+	for i := range m.cols {
+		if j := m.cols[i].indexOf(id); j >= 0 {
+			return m.cols[i].status, j
+		}
+	}
+	return m.focused, -1
+}
+
+// SetStatus shows s under the board until the next key press.
+func (m *Board) SetStatus(s string) {
+	m.status = s
+}
+
+// Owner returns the name of the owner of the board.
+func (m *Board) Owner() string {
+	return m.owner
+}
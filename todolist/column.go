@@ -1,6 +1,11 @@
 package todolist
 
 import (
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"github.com/ReggieReo/todo-elm/theme"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
@@ -31,12 +36,35 @@ func (c *column) Focused() bool {
 
 func newColumn(status status) column {
 	var focus bool
-	if status == todo {
+	if status == defaultFocus {
 		focus = true
 	}
 	defaultList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
 	defaultList.SetShowHelp(false)
-	return column{focus: focus, status: status, list: defaultList}
+	defaultList.KeyMap = listKeyMap()
+	defaultList.Filter = filterTasks
+	c := column{focus: focus, status: status, list: defaultList}
+	c.applyTheme(theme.Current())
+	return c
+}
+
+// applyTheme styles the list items and title with the colors of t.
+func (c *column) applyTheme(t theme.Theme) {
+	d := list.NewDefaultDelegate()
+	if t.Name == theme.NoColor {
+		d.Styles.NormalTitle = d.Styles.NormalTitle.UnsetForeground()
+		d.Styles.NormalDesc = d.Styles.NormalDesc.UnsetForeground().Faint(true)
+		d.Styles.SelectedTitle = d.Styles.SelectedTitle.UnsetForeground().UnsetBorderForeground().Bold(true)
+		d.Styles.SelectedDesc = d.Styles.SelectedDesc.UnsetForeground().UnsetBorderForeground()
+		d.Styles.DimmedTitle = d.Styles.DimmedTitle.UnsetForeground().Faint(true)
+		d.Styles.DimmedDesc = d.Styles.DimmedDesc.UnsetForeground().Faint(true)
+	} else {
+		d.Styles.NormalDesc = d.Styles.NormalDesc.Foreground(t.Muted)
+		d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(t.Accent).BorderForeground(t.Accent)
+		d.Styles.SelectedDesc = d.Styles.SelectedDesc.Foreground(t.Accent).BorderForeground(t.Accent)
+	}
+	c.list.SetDelegate(d)
+	c.list.Styles.Title = t.TitleStyle()
 }
 
 // Init does initial setup for the column.
@@ -57,7 +85,8 @@ func (c column) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if len(c.list.VisibleItems()) != 0 {
 				task := c.list.SelectedItem().(Task)
 				f := NewForm(task.title, task.description)
-				f.index = c.list.Index()
+				f.task = task
+				f.index = c.list.GlobalIndex()
 				f.col = c
 				return f.Update(nil)
 			}
@@ -90,7 +119,8 @@ type deleteMsg struct {
 
 func (c *column) DeleteCurrent() tea.Cmd {
 	if len(c.list.VisibleItems()) > 0 {
-		c.list.RemoveItem(c.list.Index())
+		c.list.RemoveItem(c.list.GlobalIndex())
+		c.refilter()
 	}
 
 	var cmd tea.Cmd
@@ -99,10 +129,74 @@ func (c *column) DeleteCurrent() tea.Cmd {
 }
 
 func (c *column) Set(i int, t Task) tea.Cmd {
+	var cmd tea.Cmd
 	if i != APPEND {
-		return c.list.SetItem(i, t)
+		cmd = c.list.SetItem(i, t)
+	} else {
+		cmd = c.list.InsertItem(APPEND, t)
+	}
+	if c.list.FilterState() != list.Unfiltered {
+		c.refilter()
+		return nil
 	}
-	return c.list.InsertItem(APPEND, t)
+	return cmd
+}
+
+// setTasks replaces the tasks of the column, keeping the cursor where it
+// was as far as possible.
+func (c *column) setTasks(tasks []persistence.Task) {
+	selected := c.list.Index()
+	c.list.SetItems(taskItems(tasks))
+	c.refilter()
+	if n := len(c.list.VisibleItems()); selected >= n {
+		selected = n - 1
+	}
+	if selected >= 0 {
+		c.list.Select(selected)
+	}
+}
+
+// indexOf returns the index of the task with the given ID in the column, or
+// -1 if it is not there.
+func (c *column) indexOf(id string) int {
+	for i, item := range c.list.Items() {
+		if item.(Task).stored.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// refilter applies the filter of the list again after its items changed.
+// The list would filter in a command, whose result reaches the focused
+// column, which need not be this one.
+func (c *column) refilter() {
+	if c.list.FilterState() != list.Unfiltered {
+		c.list.SetFilterText(c.list.FilterValue())
+	}
+}
+
+// assignedFilter starts the filter term that shows the tasks assigned to a
+// user, see Board.applyFilter.
+const assignedFilter = "assigned:"
+
+// filterTasks filters the tasks of a column by their title, or by assignee
+// for a term starting with assignedFilter.
+func filterTasks(term string, targets []string) []list.Rank {
+	if user, ok := strings.CutPrefix(term, assignedFilter); ok {
+		var ranks []list.Rank
+		for i, target := range targets {
+			if _, assignee, _ := strings.Cut(target, assigneeSep); assignee == user {
+				ranks = append(ranks, list.Rank{Index: i})
+			}
+		}
+		return ranks
+	}
+	titles := make([]string, len(targets))
+	for i, target := range targets {
+		titles[i], _, _ = strings.Cut(target, assigneeSep)
+	}
+	return list.DefaultFilter(term, titles)
 }
 
 func (c *column) setSize(width, height int) {
@@ -113,8 +207,8 @@ func (c *column) getStyle() lipgloss.Style {
 	if c.Focused() {
 		return lipgloss.NewStyle().
 			Padding(1, 2).
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("62")).
+			Border(theme.Current().Border).
+			BorderForeground(theme.Current().Accent).
 			Height(c.height).
 			Width(c.width)
 	}
@@ -133,8 +227,14 @@ func (c *column) MoveToNext() tea.Cmd {
 		return nil
 	}
 	// move item
-	c.list.RemoveItem(c.list.Index())
+	c.list.RemoveItem(c.list.GlobalIndex())
+	c.refilter()
 	task.status = c.status.getNext()
+	task.stored.Completed = nil
+	if task.status == done {
+		now := time.Now()
+		task.stored.Completed = &now
+	}
 
 	// refresh list
 	var cmd tea.Cmd
@@ -0,0 +1,98 @@
+package todolist
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ReggieReo/todo-elm/config"
+)
+
+// Settings applied to every board, set by Configure.
+var (
+	columnTitles = map[status]string{
+		todo:       "To Do",
+		inProgress: "In Progress",
+		done:       "Done",
+	}
+	defaultFocus = todo
+	exportDir    = "exports"
+	boardsToOpen = map[string]string{}
+	todoTxtSync  = map[string]string{}
+	icalFiles    = map[string]string{}
+	icalEvents   = false
+)
+
+var columnNames = map[string]status{
+	config.ColumnTodo:       todo,
+	config.ColumnInProgress: inProgress,
+	config.ColumnDone:       done,
+}
+
+// Configure applies the key bindings and column settings from cfg.
+// It must be called before NewBoard. Unknown actions are reported as errors
+// and leave the default bindings in place.
+func Configure(cfg config.Config) error {
+	var errs []error
+
+	bindings := keys.byName()
+	actions := make([]string, 0, len(cfg.Keys))
+	for action := range cfg.Keys {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		ks := cfg.Keys[action]
+		b, ok := bindings[action]
+		if !ok {
+			errs = append(errs, fmt.Errorf("keys.%s: unknown action (want one of %s)", action, actionNames()))
+			continue
+		}
+		if len(ks) == 0 {
+			continue
+		}
+		b.SetKeys(ks...)
+		b.SetHelp(strings.Join(ks, "/"), b.Help().Desc)
+	}
+
+	for name, title := range cfg.Board.Columns {
+		if s, ok := columnNames[name]; ok {
+			columnTitles[s] = title
+		}
+	}
+	for user, owner := range cfg.Board.Open {
+		boardsToOpen[user] = owner
+	}
+	for user, path := range cfg.TodoTxt.Sync {
+		todoTxtSync[user] = path
+	}
+	for user, path := range cfg.ICal.Files {
+		icalFiles[user] = path
+	}
+	icalEvents = cfg.ICal.Events
+	if cfg.Export.Dir != "" {
+		exportDir = cfg.Export.Dir
+	}
+	if s, ok := columnNames[cfg.Board.DefaultColumn]; ok {
+		defaultFocus = s
+	}
+
+	return errors.Join(errs...)
+}
+
+// BoardToOpen returns the owner of the board configured to open when
+// username signs in, if any.
+func BoardToOpen(username string) (string, bool) {
+	owner, ok := boardsToOpen[username]
+	return owner, ok
+}
+
+func actionNames() string {
+	names := make([]string, 0, len(keys.byName()))
+	for name := range keys.byName() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
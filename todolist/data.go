@@ -1,6 +1,8 @@
 package todolist
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
 	persistence "github.com/ReggieReo/todo-elm/persistance"
@@ -18,9 +20,9 @@ func (b *Board) initLists() {
 	}
 
 	// Set column titles
-	b.cols[todo].list.Title = "To Do"
-	b.cols[inProgress].list.Title = "In Progress"
-	b.cols[done].list.Title = "Done"
+	b.cols[todo].list.Title = columnTitles[todo]
+	b.cols[inProgress].list.Title = columnTitles[inProgress]
+	b.cols[done].list.Title = columnTitles[done]
 
 	// Load tasks from the database
 	b.loadTasks()
@@ -28,124 +30,93 @@ func (b *Board) initLists() {
 
 // loadTasks loads tasks from the database
 func (b *Board) loadTasks() {
-	// Load todo tasks
-	todoTasks, err := b.store.LoadTasks(b.username, persistence.Todo)
+	board, err := b.store.LoadBoard(b.username, b.owner)
 	if err != nil {
-		log.Printf("Error loading todo tasks: %v", err)
+		log.Printf("Error loading tasks: %v", err)
 		// Fall back to default tasks if error occurs
-		b.loadDefaultTasks()
+		b.loadFailed(err)
 		return
 	}
+	b.showColumns(board.Columns)
+	b.saved = board
+}
 
-	// Load in-progress tasks
-	inProgressTasks, err := b.store.LoadTasks(b.username, persistence.InProgress)
-	if err != nil {
-		log.Printf("Error loading in-progress tasks: %v", err)
-		b.loadDefaultTasks()
-		return
+// taskItems converts persisted tasks to list items.
+func taskItems(tasks []persistence.Task) []list.Item {
+	items := make([]list.Item, len(tasks))
+	for i, t := range tasks {
+		items[i] = taskFromStored(t)
 	}
+	return items
+}
 
-	// Load done tasks
-	doneTasks, err := b.store.LoadTasks(b.username, persistence.Done)
-	if err != nil {
-		log.Printf("Error loading done tasks: %v", err)
+// loadFailed handles a board that could not be loaded. The user's own board
+// gets the demo tasks; a shared board stays empty and read-only, so that it
+// is not overwritten.
+func (b *Board) loadFailed(err error) {
+	if b.owner == b.username {
 		b.loadDefaultTasks()
 		return
 	}
-
-	// Convert persistence tasks to todolist tasks and add to columns
-	var todoItems []list.Item
-	for _, t := range todoTasks {
-		todoItems = append(todoItems, Task{
-			status:      status(t.Status),
-			title:       t.Title,
-			description: t.Description,
-		})
-	}
-	b.cols[todo].list.SetItems(todoItems)
-
-	var inProgressItems []list.Item
-	for _, t := range inProgressTasks {
-		inProgressItems = append(inProgressItems, Task{
-			status:      status(t.Status),
-			title:       t.Title,
-			description: t.Description,
-		})
-	}
-	b.cols[inProgress].list.SetItems(inProgressItems)
-
-	var doneItems []list.Item
-	for _, t := range doneTasks {
-		doneItems = append(doneItems, Task{
-			status:      status(t.Status),
-			title:       t.Title,
-			description: t.Description,
-		})
-	}
-	b.cols[done].list.SetItems(doneItems)
+	b.readOnly = true
+	b.status = fmt.Sprintf("Could not open %s's board: %v", b.owner, err)
 }
 
 // loadDefaultTasks loads default demo tasks if no tasks are found in the database
 func (b *Board) loadDefaultTasks() {
 	// Init To Do
 	b.cols[todo].list.SetItems([]list.Item{
-		Task{status: todo, title: "buy milk", description: "strawberry milk"},
-		Task{status: todo, title: "eat sushi", description: "negitoro roll, miso soup, rice"},
-		Task{status: todo, title: "fold laundry", description: "or wear wrinkly t-shirts"},
+		NewTask(todo, "buy milk", "strawberry milk"),
+		NewTask(todo, "eat sushi", "negitoro roll, miso soup, rice"),
+		NewTask(todo, "fold laundry", "or wear wrinkly t-shirts"),
 	})
 	// Init in progress
 	b.cols[inProgress].list.SetItems([]list.Item{
-		Task{status: inProgress, title: "write code", description: "don't worry, it's Go"},
+		NewTask(inProgress, "write code", "don't worry, it's Go"),
 	})
 	// Init done
 	b.cols[done].list.SetItems([]list.Item{
-		Task{status: done, title: "stay cool", description: "as a cucumber"},
+		NewTask(done, "stay cool", "as a cucumber"),
 	})
 }
 
-// saveTasks saves all tasks to the database
+// saveTasks saves all tasks to the database. If the board was saved
+// elsewhere since it was loaded, e.g. from another terminal connected to
+// the same server, nothing is saved: the user is asked whether to merge the
+// changes or reload the board, see resolveConflict.
 func (b *Board) saveTasks() error {
-	// Save todo tasks
-	var todoTasks []persistence.Task
-	for _, item := range b.cols[todo].list.Items() {
-		task := item.(Task)
-		todoTasks = append(todoTasks, persistence.Task{
-			Status:      persistence.TaskStatus(task.status),
-			Title:       task.title,
-			Description: task.description,
-		})
-	}
-	if err := b.store.SaveTasks(b.username, persistence.Todo, todoTasks); err != nil {
-		return err
+	if b.readOnly {
+		return nil
 	}
 
-	// Save in-progress tasks
-	var inProgressTasks []persistence.Task
-	for _, item := range b.cols[inProgress].list.Items() {
-		task := item.(Task)
-		inProgressTasks = append(inProgressTasks, persistence.Task{
-			Status:      persistence.TaskStatus(task.status),
-			Title:       task.title,
-			Description: task.description,
-		})
-	}
-	if err := b.store.SaveTasks(b.username, persistence.InProgress, inProgressTasks); err != nil {
+	columns := b.columns()
+	rev, err := b.store.SaveBoard(b.username, b.owner, persistence.BoardTasks{Revision: b.saved.Revision, Columns: columns})
+	if errors.Is(err, persistence.ErrConflict) {
+		theirs, lerr := b.store.LoadBoard(b.username, b.owner)
+		if lerr != nil {
+			return lerr
+		}
+		b.conflict = &theirs
 		return err
 	}
-
-	// Save done tasks
-	var doneTasks []persistence.Task
-	for _, item := range b.cols[done].list.Items() {
-		task := item.(Task)
-		doneTasks = append(doneTasks, persistence.Task{
-			Status:      persistence.TaskStatus(task.status),
-			Title:       task.title,
-			Description: task.description,
-		})
-	}
-	if err := b.store.SaveTasks(b.username, persistence.Done, doneTasks); err != nil {
+	if err != nil {
 		return err
 	}
+	b.saved = persistence.BoardTasks{Revision: rev, Columns: columns}
 
+	b.afterSave()
 	return nil
 }
+
+// columns returns the tasks of every column, as saved.
+func (b *Board) columns() [][]persistence.Task {
+	columns := make([][]persistence.Task, len(b.cols))
+	for i := range b.cols {
+		var tasks []persistence.Task
+		for _, item := range b.cols[i].list.Items() {
+			tasks = append(tasks, item.(Task).toStored())
+		}
+		columns[i] = tasks
+	}
+	return columns
+}
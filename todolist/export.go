@@ -0,0 +1,33 @@
+package todolist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// titlesByName returns the column titles keyed by the column names used in
+// config and export files.
+func titlesByName() map[string]string {
+	titles := make(map[string]string, len(columnTitles))
+	for s, title := range columnTitles {
+		titles[persistence.TaskStatus(s).String()] = title
+	}
+	return titles
+}
+
+// export writes the saved board in every export format to the export
+// directory and returns a status line describing the result.
+func (m *Board) export() string {
+	doc, err := interchange.LoadBoardDocument(m.store, m.username, m.owner, titlesByName())
+	if err != nil {
+		return fmt.Sprintf("Export failed: %v", err)
+	}
+	paths, err := interchange.ExportAll(exportDir, m.owner, doc)
+	if err != nil {
+		return fmt.Sprintf("Export failed: %v", err)
+	}
+	return "Exported to " + strings.Join(paths, ", ")
+}
@@ -1,6 +1,7 @@
 package todolist
 
 import (
+	"github.com/ReggieReo/todo-elm/theme"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textarea"
@@ -15,10 +16,14 @@ type Form struct {
 	description textarea.Model
 	col         column
 	index       int
+	task        Task   // task being edited, or a new task
+	board       *Board // returned to when done, set by Board.Update
 }
 
 func newDefaultForm() *Form {
-	return NewForm("task name", "task description")
+	f := NewForm("task name", "task description")
+	f.task = NewTask(todo, "", "")
+	return f
 }
 
 func NewForm(title, description string) *Form {
@@ -29,12 +34,24 @@ func NewForm(title, description string) *Form {
 	}
 	form.title.Placeholder = title
 	form.description.Placeholder = description
+	t := theme.Current()
+	form.title.PromptStyle = lipgloss.NewStyle().Foreground(t.Accent)
+	form.title.PlaceholderStyle = t.MutedStyle()
+	form.description.FocusedStyle.Prompt = lipgloss.NewStyle().Foreground(t.Accent)
+	form.description.FocusedStyle.Placeholder = t.MutedStyle()
+	form.description.BlurredStyle.Placeholder = t.MutedStyle()
 	form.title.Focus()
 	return &form
 }
 
+// CreateTask returns the edited task, keeping the fields the form does not
+// show.
 func (f Form) CreateTask() Task {
-	return Task{f.col.status, f.title.Value(), f.description.Value()}
+	t := f.task
+	t.status = f.col.status
+	t.title = f.title.Value()
+	t.description = f.description.Value()
+	return t
 }
 
 func (f Form) Init() tea.Cmd {
@@ -47,13 +64,16 @@ func (f *Form) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case column:
 		f.col = msg
 		f.col.list.Index()
+	case RefreshMsg:
+		_, cmd = f.board.Update(msg)
+		return f, cmd
 	case tea.KeyMsg:
 		switch {
 		case key.Matches(msg, keys.Quit):
 			return f, tea.Quit
 
 		case key.Matches(msg, keys.Back):
-			return board.Update(nil)
+			return f.board.Update(nil)
 		case key.Matches(msg, keys.Enter):
 			if f.title.Focused() {
 				f.title.Blur()
@@ -61,7 +81,7 @@ func (f *Form) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return f, textarea.Blink
 			}
 			// Return the completed form as a message.
-			return board.Update(f)
+			return f.board.Update(f)
 		}
 	}
 	if f.title.Focused() {
@@ -75,7 +95,7 @@ func (f *Form) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (f Form) View() string {
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
-		"Create a new task",
+		theme.Current().TitleStyle().Render("Create a new task"),
 		f.title.View(),
 		f.description.View(),
 		f.help.View(keys))
@@ -1,6 +1,9 @@
 package todolist
 
-import "github.com/charmbracelet/bubbles/key"
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
 
 // ShortHelp returns keybindings to be shown in the mini help view. It's part
 // of the key.Map interface.
@@ -18,25 +21,39 @@ func (k keyMap) FullHelp() [][]key.Binding {
 			k.New,  
 			k.Edit,  
 			k.Delete,
+			k.Assign,
+			k.Mine,
+			k.MyTasks,
 			k.LogOut,
+			k.Theme,
+			k.Export,
+			k.Boards,
+			k.Account,
 		},
 		{k.Help, k.Quit}, // second column
 	}
 }
 
 type keyMap struct {
-	New    key.Binding
-	Edit   key.Binding
-	Delete key.Binding
-	Up     key.Binding
-	Down   key.Binding
-	Right  key.Binding
-	Left   key.Binding
-	Enter  key.Binding
-	Help   key.Binding
-	Quit   key.Binding
-	Back   key.Binding
-	LogOut key.Binding
+	New     key.Binding
+	Edit    key.Binding
+	Delete  key.Binding
+	Assign  key.Binding
+	Mine    key.Binding
+	Up      key.Binding
+	Down    key.Binding
+	Right   key.Binding
+	Left    key.Binding
+	Enter   key.Binding
+	Help    key.Binding
+	Quit    key.Binding
+	Back    key.Binding
+	LogOut  key.Binding
+	Theme   key.Binding
+	Export  key.Binding
+	Boards  key.Binding
+	Account key.Binding
+	MyTasks key.Binding
 }
 
 var keys = keyMap{
@@ -52,6 +69,14 @@ var keys = keyMap{
 		key.WithKeys("d"),
 		key.WithHelp("d", "delete"),
 	),
+	Assign: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "assign"),
+	),
+	Mine: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "assigned to me"),
+	),
 	Up: key.NewBinding(
 		key.WithKeys("up", "k"),
 		key.WithHelp("↑/k", "move up"),
@@ -88,4 +113,84 @@ var keys = keyMap{
 		key.WithKeys("b"),
 		key.WithHelp("b", "LogOut"),
 	),
+	Theme: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "switch theme"),
+	),
+	Export: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "export"),
+	),
+	Boards: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "open board"),
+	),
+	Account: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "account"),
+	),
+	MyTasks: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "my tasks"),
+	),
+}
+
+// byName returns the bindings that can be rebound from the config file,
+// indexed by their action name.
+func (k *keyMap) byName() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"new":      &k.New,
+		"edit":     &k.Edit,
+		"delete":   &k.Delete,
+		"assign":   &k.Assign,
+		"mine":     &k.Mine,
+		"up":       &k.Up,
+		"down":     &k.Down,
+		"right":    &k.Right,
+		"left":     &k.Left,
+		"enter":    &k.Enter,
+		"help":     &k.Help,
+		"quit":     &k.Quit,
+		"back":     &k.Back,
+		"log_out":  &k.LogOut,
+		"theme":    &k.Theme,
+		"export":   &k.Export,
+		"boards":   &k.Boards,
+		"account":  &k.Account,
+		"my_tasks": &k.MyTasks,
+	}
+}
+
+// listKeyMap returns the default list key map with the cursor moved by the
+// up and down bindings, so that rebinding them in the config takes effect.
+func listKeyMap() list.KeyMap {
+	km := list.DefaultKeyMap()
+	km.CursorUp = keys.Up
+	km.CursorDown = keys.Down
+	return km
+}
+
+// QuitKey returns the binding that quits the application.
+func QuitKey() key.Binding {
+	return keys.Quit
+}
+
+// LogOutKey returns the binding that logs out of the board.
+func LogOutKey() key.Binding {
+	return keys.LogOut
+}
+
+// AccountKey returns the binding that opens the account menu.
+func AccountKey() key.Binding {
+	return keys.Account
+}
+
+// BoardsKey returns the binding that opens another board.
+func BoardsKey() key.Binding {
+	return keys.Boards
+}
+
+// BackKey returns the binding that leaves a form or menu.
+func BackKey() key.Binding {
+	return keys.Back
 }
@@ -0,0 +1,25 @@
+package todolist
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ReggieReo/todo-elm/config"
+)
+
+func TestConfigureMovesListCursor(t *testing.T) {
+	saved := keys
+	t.Cleanup(func() { keys = saved })
+
+	err := Configure(config.Config{Keys: map[string][]string{"up": {"w"}, "down": {"s"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	km := newColumn(todo).list.KeyMap
+	if got := km.CursorUp.Keys(); !reflect.DeepEqual(got, []string{"w"}) {
+		t.Errorf("cursor up keys = %v, want [w]", got)
+	}
+	if got := km.CursorDown.Keys(); !reflect.DeepEqual(got, []string{"s"}) {
+		t.Errorf("cursor down keys = %v, want [s]", got)
+	}
+}
@@ -0,0 +1,105 @@
+package todolist
+
+import (
+	"bytes"
+	"encoding/json"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+// placed is a task with the column it is in.
+type placed struct {
+	col  int
+	task persistence.Task
+}
+
+// placeTasks indexes the tasks of columns by ID.
+func placeTasks(columns [][]persistence.Task) map[string]placed {
+	tasks := map[string]placed{}
+	for col, column := range columns {
+		for _, t := range column {
+			tasks[t.ID] = placed{col, t}
+		}
+	}
+	return tasks
+}
+
+// samePlace reports whether a task is in the same column with the same
+// fields in both places.
+func samePlace(a, b placed) bool {
+	if a.col != b.col {
+		return false
+	}
+	// Compared as stored, without the monotonic clock of new times
+	ja, erra := json.Marshal(a.task)
+	jb, errb := json.Marshal(b.task)
+	return erra == nil && errb == nil && bytes.Equal(ja, jb)
+}
+
+// mergeColumns merges the changes made on this board to the columns loaded
+// as base, mine, into the columns saved elsewhere since, theirs. A task
+// changed on both sides, or changed on one and deleted on the other, keeps
+// this board's version; the number of such tasks is returned. Tasks keep
+// their place in theirs; tasks added or moved here go to the end of their
+// column, as on the board.
+func mergeColumns(base, mine, theirs [][]persistence.Task) ([][]persistence.Task, int) {
+	merged := make([][]persistence.Task, len(theirs))
+	for i := range theirs {
+		merged[i] = append([]persistence.Task(nil), theirs[i]...)
+	}
+	baseTasks, mineTasks, theirTasks := placeTasks(base), placeTasks(mine), placeTasks(theirs)
+	conflicts := 0
+
+	for col, column := range mine {
+		for _, t := range column {
+			here := placed{col, t}
+			b, inBase := baseTasks[t.ID]
+			there, inTheirs := theirTasks[t.ID]
+			if inBase && samePlace(b, here) {
+				// Unchanged here: theirs is kept, changed or deleted
+				continue
+			}
+			if inBase && (!inTheirs || !samePlace(b, there)) {
+				conflicts++
+			}
+			if inTheirs && there.col == col {
+				merged[col][indexOf(merged[col], t.ID)] = t
+				continue
+			}
+			merged = removeTask(merged, t.ID)
+			merged[col] = append(merged[col], t)
+		}
+	}
+
+	for id, b := range baseTasks {
+		if _, kept := mineTasks[id]; kept {
+			continue
+		}
+		// Deleted here
+		if there, inTheirs := theirTasks[id]; inTheirs {
+			if !samePlace(b, there) {
+				conflicts++
+			}
+			merged = removeTask(merged, id)
+		}
+	}
+	return merged, conflicts
+}
+
+func indexOf(tasks []persistence.Task, id string) int {
+	for i, t := range tasks {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeTask(columns [][]persistence.Task, id string) [][]persistence.Task {
+	for col, tasks := range columns {
+		if i := indexOf(tasks, id); i >= 0 {
+			columns[col] = append(tasks[:i:i], tasks[i+1:]...)
+		}
+	}
+	return columns
+}
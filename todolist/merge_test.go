@@ -0,0 +1,120 @@
+package todolist
+
+import (
+	"reflect"
+	"testing"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
+func task(id, title string) persistence.Task {
+	return persistence.Task{ID: id, Title: title}
+}
+
+// titles lists the titles of each column.
+func titles(columns [][]persistence.Task) [][]string {
+	out := make([][]string, len(columns))
+	for col, tasks := range columns {
+		out[col] = []string{}
+		for _, t := range tasks {
+			out[col] = append(out[col], t.Title)
+		}
+	}
+	return out
+}
+
+func TestMergeColumns(t *testing.T) {
+	base := [][]persistence.Task{{task("a", "a"), task("b", "b")}, {}, {}}
+	tests := []struct {
+		name          string
+		mine, theirs  [][]persistence.Task
+		want          [][]string
+		wantConflicts int
+	}{
+		{
+			name:   "unchanged",
+			mine:   base,
+			theirs: base,
+			want:   [][]string{{"a", "b"}, {}, {}},
+		},
+		{
+			name:   "edited here",
+			mine:   [][]persistence.Task{{task("a", "a mine"), task("b", "b")}, {}, {}},
+			theirs: base,
+			want:   [][]string{{"a mine", "b"}, {}, {}},
+		},
+		{
+			name:   "edited there",
+			mine:   base,
+			theirs: [][]persistence.Task{{task("a", "a theirs"), task("b", "b")}, {}, {}},
+			want:   [][]string{{"a theirs", "b"}, {}, {}},
+		},
+		{
+			name:          "edit/edit",
+			mine:          [][]persistence.Task{{task("a", "a mine"), task("b", "b")}, {}, {}},
+			theirs:        [][]persistence.Task{{task("a", "a theirs"), task("b", "b")}, {}, {}},
+			want:          [][]string{{"a mine", "b"}, {}, {}},
+			wantConflicts: 1,
+		},
+		{
+			name:          "edit/delete",
+			mine:          [][]persistence.Task{{task("a", "a mine"), task("b", "b")}, {}, {}},
+			theirs:        [][]persistence.Task{{task("b", "b")}, {}, {}},
+			want:          [][]string{{"b", "a mine"}, {}, {}},
+			wantConflicts: 1,
+		},
+		{
+			name:          "delete/edit",
+			mine:          [][]persistence.Task{{task("b", "b")}, {}, {}},
+			theirs:        [][]persistence.Task{{task("a", "a theirs"), task("b", "b")}, {}, {}},
+			want:          [][]string{{"b"}, {}, {}},
+			wantConflicts: 1,
+		},
+		{
+			name:   "delete/unchanged",
+			mine:   [][]persistence.Task{{task("b", "b")}, {}, {}},
+			theirs: base,
+			want:   [][]string{{"b"}, {}, {}},
+		},
+		{
+			name:          "move/edit",
+			mine:          [][]persistence.Task{{task("b", "b")}, {task("a", "a")}, {}},
+			theirs:        [][]persistence.Task{{task("a", "a theirs"), task("b", "b")}, {}, {}},
+			want:          [][]string{{"b"}, {"a"}, {}},
+			wantConflicts: 1,
+		},
+		{
+			name:   "move/move elsewhere",
+			mine:   [][]persistence.Task{{task("b", "b")}, {task("a", "a")}, {}},
+			theirs: [][]persistence.Task{{task("a", "a")}, {}, {task("b", "b")}},
+			want:   [][]string{{}, {"a"}, {"b"}},
+		},
+		{
+			name:   "added on both sides",
+			mine:   [][]persistence.Task{{task("a", "a"), task("b", "b"), task("c", "c")}, {}, {}},
+			theirs: [][]persistence.Task{{task("a", "a"), task("b", "b")}, {task("d", "d")}, {}},
+			want:   [][]string{{"a", "b", "c"}, {"d"}, {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := mergeColumns(base, tt.mine, tt.theirs)
+			if got := titles(merged); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged = %v, want %v", got, tt.want)
+			}
+			if conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMergeColumnsKeepsTheirs(t *testing.T) {
+	base := [][]persistence.Task{{task("a", "a")}, {}, {}}
+	theirs := [][]persistence.Task{{task("a", "a theirs")}, {}, {}}
+	mine := [][]persistence.Task{{task("a", "a")}, {task("c", "c")}, {}}
+	mergeColumns(base, mine, theirs)
+	if theirs[0][0].Title != "a theirs" || len(theirs[1]) != 0 {
+		t.Errorf("theirs was changed: %v", titles(theirs))
+	}
+}
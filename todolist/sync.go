@@ -0,0 +1,53 @@
+package todolist
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ReggieReo/todo-elm/interchange"
+)
+
+// afterSave keeps the files configured for the user in step with the saved
+// board, if it is their own. It reloads the columns when a sync changed the board.
+func (b *Board) afterSave() {
+	if b.syncTodoTxt() {
+		b.loadTasks()
+	}
+	b.writeICal()
+}
+
+// syncTodoTxt reconciles the saved board with the user's todo.txt file, if
+// one is configured and the store is not read-only, and reports whether the
+// saved board changed.
+func (b *Board) syncTodoTxt() bool {
+	path, ok := todoTxtSync[b.username]
+	if !ok || b.owner != b.username || b.store.ReadOnly() {
+		return false
+	}
+	res, err := interchange.SyncTodoTxt(b.store, b.username, path)
+	if err != nil {
+		log.Printf("Error syncing %s: %v", path, err)
+		b.status = fmt.Sprintf("todo.txt sync failed: %v", err)
+		return false
+	}
+	if res.Conflicts > 0 {
+		b.status = fmt.Sprintf("todo.txt: %d tasks changed on both sides, kept the board's version", res.Conflicts)
+	}
+	return res.BoardChanged()
+}
+
+// writeICal regenerates the user's calendar file, if one is configured.
+func (b *Board) writeICal() {
+	path, ok := icalFiles[b.username]
+	if !ok || b.owner != b.username {
+		return
+	}
+	doc, err := interchange.LoadDocument(b.store, b.username, titlesByName())
+	if err == nil {
+		err = interchange.WriteICalFile(path, doc, interchange.ICalOptions{Events: icalEvents})
+	}
+	if err != nil {
+		log.Printf("Error writing %s: %v", path, err)
+		b.status = fmt.Sprintf("Calendar export failed: %v", err)
+	}
+}
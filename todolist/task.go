@@ -1,5 +1,12 @@
 package todolist
 
+import (
+	"strings"
+	"time"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+)
+
 type status int
 
 const (
@@ -28,10 +35,38 @@ type Task struct {
 	status      status
 	title       string
 	description string
+	// stored keeps the fields the board does not edit, such as the ID,
+	// tags and due date, so that saving the board does not drop them.
+	stored persistence.Task
 }
 
 func NewTask(status status, title, description string) Task {
-	return Task{status: status, title: title, description: description}
+	now := time.Now()
+	return Task{
+		status:      status,
+		title:       title,
+		description: description,
+		stored:      persistence.Task{ID: persistence.NewTaskID(), Created: &now},
+	}
+}
+
+// taskFromStored converts a persisted task for display on the board.
+func taskFromStored(t persistence.Task) Task {
+	return Task{
+		status:      status(t.Status),
+		title:       t.Title,
+		description: t.Description,
+		stored:      t,
+	}
+}
+
+// toStored converts the task back for persistence.
+func (t Task) toStored() persistence.Task {
+	s := t.stored
+	s.Status = persistence.TaskStatus(t.status)
+	s.Title = t.title
+	s.Description = t.description
+	return s
 }
 
 func (t *Task) Next() {
@@ -42,15 +77,57 @@ func (t *Task) Next() {
 	}
 }
 
+// assigneeSep separates the title from the assignee in the filter value of
+// a task, see filterTasks.
+const assigneeSep = "\x1f"
+
 // implement the list.Item interface
 func (t Task) FilterValue() string {
-	return t.title
+	return t.title + assigneeSep + t.stored.Assignee
 }
 
+// Title shows the initials of the assignee and the priority before the
+// title.
 func (t Task) Title() string {
-	return t.title
+	title := t.title
+	if t.stored.Priority != "" {
+		title = "(" + t.stored.Priority + ") " + title
+	}
+	if t.stored.Assignee != "" {
+		title = "[" + initials(t.stored.Assignee) + "] " + title
+	}
+	return title
 }
 
+// initials abbreviates a username for the task list: "jane.doe" is "JD"
+// and "alice" is "AL".
+func initials(username string) string {
+	parts := strings.FieldsFunc(username, func(r rune) bool {
+		return strings.ContainsRune("._-", r)
+	})
+	var r []rune
+	if len(parts) >= 2 {
+		r = []rune{[]rune(parts[0])[0], []rune(parts[1])[0]}
+	} else {
+		r = []rune(username)
+		r = r[:min(len(r), 2)]
+	}
+	return strings.ToUpper(string(r))
+}
+
+// Description shows the due date and tags before the description, as the
+// list only has room for one line.
 func (t Task) Description() string {
-	return t.description
+	var meta []string
+	if t.stored.Due != nil {
+		meta = append(meta, "due "+t.stored.Due.Format("2006-01-02"))
+	}
+	meta = append(meta, t.stored.Tags...)
+	if len(meta) == 0 {
+		return t.description
+	}
+	if t.description == "" {
+		return strings.Join(meta, " ")
+	}
+	return strings.Join(meta, " ") + " · " + t.description
 }
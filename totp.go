@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	persistence "github.com/ReggieReo/todo-elm/persistance"
+	"github.com/ReggieReo/todo-elm/theme"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+)
+
+type secondFactorMsg struct{}
+type totpBeganMsg struct{ enrollment persistence.TOTPEnrollment }
+type totpEnabledMsg struct{ codes []string }
+type totpDisabledMsg struct{}
+
+// beginTOTPCmd creates a tea.Cmd that starts enrolling the signed in user in
+// two-factor authentication.
+func beginTOTPCmd(store persistence.Backend, username string) tea.Cmd {
+	return func() tea.Msg {
+		e, err := store.BeginTOTP(username)
+		if err != nil {
+			return authErrMsg{err}
+		}
+		return totpBeganMsg{enrollment: e}
+	}
+}
+
+// confirmTOTPCmd creates a tea.Cmd that finishes the enrollment with a code
+// from the authenticator app.
+func confirmTOTPCmd(store persistence.Backend, username, code string) tea.Cmd {
+	return func() tea.Msg {
+		codes, err := store.ConfirmTOTP(username, code)
+		if err != nil {
+			return authErrMsg{err}
+		}
+		return totpEnabledMsg{codes: codes}
+	}
+}
+
+// disableTOTPCmd creates a tea.Cmd that turns two-factor authentication off.
+func disableTOTPCmd(store persistence.Backend, username, password, code string) tea.Cmd {
+	return func() tea.Msg {
+		if err := store.DisableTOTP(username, password, code); err != nil {
+			return authErrMsg{err}
+		}
+		return totpDisabledMsg{}
+	}
+}
+
+func validateCode(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return errors.New("code cannot be empty")
+	}
+	return nil
+}
+
+// createCodeForm asks for the second factor after the password.
+func createCodeForm() *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("code").
+				Title("Authentication Code").
+				Description("From your authenticator app, or one of your recovery codes.").
+				Placeholder("123456").
+				Validate(validateCode),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func createEnrollTOTPForm(e persistence.TOTPEnrollment) *huh.Form {
+	qr, err := totpQR(e)
+	if err != nil {
+		qr = e.URI
+	}
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewNote().
+				Title("Scan with your authenticator app").
+				Description(qr+"\nor enter the key "+e.Secret),
+			huh.NewInput().
+				Key("code").
+				Title("Code shown by the app").
+				Placeholder("123456").
+				Validate(validateCode),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func createRecoveryCodesForm(codes []string) *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewNote().
+				Title("Recovery codes").
+				Description("Two-factor authentication is on. Keep these codes somewhere safe; "+
+					"each can be used once instead of a code if you lose the app.\n\n"+strings.Join(codes, "\n")),
+			huh.NewConfirm().
+				Key("saved").
+				Title("I have saved my recovery codes").
+				Affirmative("Done").
+				Negative(""),
+		),
+	).WithTheme(theme.Current().Huh())
+}
+
+func createDisableTOTPForm() *huh.Form {
+	return huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Key("password").
+				Title("Password").
+				Placeholder("Enter your password").
+				EchoMode(huh.EchoModePassword).
+				Validate(func(s string) error {
+					if s == "" {
+						return errors.New("password cannot be empty")
+					}
+					return nil
+				}),
+			huh.NewInput().
+				Key("code").
+				Title("Authentication Code").
+				Placeholder("123456").
+				Validate(validateCode),
+			huh.NewConfirm().
+				Key("confirm").
+				Title("Turn off two-factor authentication?").
+				Affirmative("Turn off").
+				Negative("Cancel"),
+		),
+	).WithTheme(theme.Current().Huh())
+}